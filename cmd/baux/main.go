@@ -11,6 +11,10 @@ import (
 
 	"github.com/siggy/bbox/pkg/amplitude"
 	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/rows"
+	"github.com/siggy/bbox/pkg/simulator"
+	"github.com/siggy/bbox/pkg/tempo"
+	"github.com/siggy/bbox/pkg/web"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -25,6 +29,10 @@ const (
 
 	fps               = 30
 	defaultIntervalMS = 2000
+
+	// streaks follow the beat of the music for tempoTimeout after the last
+	// tempo estimate, and the amplitude otherwise
+	tempoTimeout = 3 * time.Second
 )
 
 var (
@@ -51,7 +59,9 @@ var (
 func main() {
 	logLevel := flag.String("log-level", "debug", "set log level (debug, info, warn, error, fatal, panic)")
 	fakeLEDs := flag.Bool("fake-leds", false, "enable fake LEDs")
+	simLEDs := flag.Bool("sim-leds", false, "render LEDs in the terminal")
 	macDevice := flag.Bool("mac-device", false, "connect to scorpio from a macbook (default is Raspberry Pi)")
+	httpAddr := flag.String("http", "", "serve a live visualizer on this address, e.g. :8080")
 	flag.Parse()
 
 	lvl, err := log.ParseLevel(*logLevel)
@@ -66,7 +76,13 @@ func main() {
 
 	// init
 	var ledStrips leds.LEDs
-	if *fakeLEDs {
+	if *simLEDs {
+		ledStrips, err = simulator.New(ctx, stripLengths, globeLayout())
+		if err != nil {
+			log.Errorf("simulator.New failed: %+v", err)
+			os.Exit(1)
+		}
+	} else if *fakeLEDs {
 		ledStrips, err = leds.NewFake(stripLengths)
 		if err != nil {
 			log.Errorf("leds.NewFake failed: %+v", err)
@@ -79,10 +95,20 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	if *httpAddr != "" {
+		server, err := web.New(ctx, *httpAddr, globeLayout(), nil)
+		if err != nil {
+			log.Errorf("web.New failed: %+v", err)
+			os.Exit(1)
+		}
+		ledStrips = leds.Multi(ledStrips, server)
+	}
 	defer ledStrips.Close()
 	ledStrips.Clear()
 
-	amp, err := amplitude.New()
+	detector := tempo.New(amplitude.SampleRate)
+
+	amp, err := amplitude.New(amplitude.WithSamples(amplitude.SampleRate, detector.AddSamples))
 	if err != nil {
 		log.Fatalf("amplitude.New failed: %v", err)
 	}
@@ -96,22 +122,37 @@ func main() {
 
 	ampLevel := 0.0
 
+	var roomTempo tempo.Tempo
+	var roomTempoAt time.Time
+
 	for {
 		select {
 		case _ = <-ticker.C:
 			ledsState := leds.State{}
 
-			interval = time.Duration(math.Max(
-				defaultIntervalMS-(defaultIntervalMS*ampLevel),
-				100,
-			)) * time.Millisecond
-
 			now := time.Now()
-			loc := 1.0 - float64(now.Sub(last).Nanoseconds())/float64(interval.Nanoseconds())
-
-			if loc < 0 {
-				loc = 1
-				last = now
+			var loc float64
+
+			if now.Sub(roomTempoAt) < tempoTimeout {
+				// one streak per beat, starting on the beat
+				interval = time.Duration(float64(time.Minute) / roomTempo.BPM)
+				since := now.Sub(roomTempo.Beat) % interval
+				if since < 0 {
+					since += interval
+				}
+				loc = 1.0 - float64(since)/float64(interval)
+			} else {
+				interval = time.Duration(math.Max(
+					defaultIntervalMS-(defaultIntervalMS*ampLevel),
+					100,
+				)) * time.Millisecond
+
+				loc = 1.0 - float64(now.Sub(last).Nanoseconds())/float64(interval.Nanoseconds())
+
+				if loc < 0 {
+					loc = 1
+					last = now
+				}
 			}
 
 			// streaks
@@ -144,9 +185,33 @@ func main() {
 		case level := <-amp.Level():
 			ampLevel = level
 
+		case t := <-detector.Tempos():
+			log.Tracef("tempo: %+v", t)
+			roomTempo = t
+			roomTempoAt = time.Now()
+
 		case <-ctx.Done():
 			log.Info("context done")
 			return
 		}
 	}
 }
+
+// globeLayout draws the base strip as one ring and each globe band as its own
+// ring.
+func globeLayout() rows.Layout {
+	layout := rows.Layout{{}}
+	for pixel := range baseLEDCount {
+		layout[0].Pixels = append(layout[0].Pixels, rows.Coord{Strip: baseLEDStrip, Pixel: pixel})
+	}
+
+	for i := 0; i < len(globeLeds)-1; i++ {
+		ring := rows.Ring{}
+		for pixel := globeLeds[i]; pixel < globeLeds[i+1] && pixel < globeLEDCount; pixel++ {
+			ring.Pixels = append(ring.Pixels, rows.Coord{Strip: globalLEDStrip, Pixel: pixel})
+		}
+		layout = append(layout, ring)
+	}
+
+	return layout
+}
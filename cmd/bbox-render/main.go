@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/siggy/bbox/pkg/config"
+	"github.com/siggy/bbox/pkg/mix"
+	log "github.com/sirupsen/logrus"
+)
+
+// bbox-render renders a beats program's starter pattern to a wav file, without
+// an audio device or LEDs.
+func main() {
+	logLevel := flag.String("log-level", "info", "set log level (debug, info, warn, error, fatal, panic)")
+	configPath := flag.String("config", filepath.Join(os.Getenv("HOME"), "code", "bbox", "config", "programs.yaml"), "program roster")
+	wavPath := flag.String("wavs", filepath.Join(os.Getenv("HOME"), "code", "bbox", "wavs"), "directory of sounds")
+	name := flag.String("program", "", "name of the beats program to render (default is the first beats program)")
+	bars := flag.Int("bars", 4, "number of times to play through the pattern")
+	out := flag.String("out", "", "wav file to write (default is <program>.wav)")
+	flag.Parse()
+
+	lvl, err := log.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	log.SetLevel(lvl)
+	log := log.WithField("bbox", "render")
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("config.Load failed: %v", err)
+	}
+
+	var program *config.Program
+	for i, p := range cfg.Programs {
+		if p.Type == config.TypeBeats && (*name == "" || p.Name == *name) {
+			program = &cfg.Programs[i]
+			break
+		}
+	}
+	if program == nil {
+		log.Fatalf("No beats program named %q in %s", *name, *configPath)
+	}
+
+	if *out == "" {
+		*out = program.Name + ".wav"
+	}
+
+	start := time.Time{}
+	sounds, end := program.Preset().Score(start, *bars)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+
+	if err := mix.Render(f, *wavPath, sounds, start, end.Sub(start)); err != nil {
+		log.Fatalf("Render failed: %v", err)
+	}
+
+	log.Infof("Rendered %d bars of %q (%d sounds) to %s", *bars, program.Name, len(sounds), *out)
+}
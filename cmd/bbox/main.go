@@ -6,51 +6,60 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"slices"
 	"syscall"
 	"time"
 
+	"github.com/siggy/bbox/pkg/amplitude"
+	"github.com/siggy/bbox/pkg/config"
+	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/input"
 	"github.com/siggy/bbox/pkg/keyboard"
 	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/midi"
+	"github.com/siggy/bbox/pkg/midiin"
+	"github.com/siggy/bbox/pkg/osc"
 	"github.com/siggy/bbox/pkg/program"
 	"github.com/siggy/bbox/pkg/programs/beats"
-	"github.com/siggy/bbox/pkg/programs/song"
+	"github.com/siggy/bbox/pkg/rows"
+	"github.com/siggy/bbox/pkg/scheduler"
+	"github.com/siggy/bbox/pkg/simulator"
+	"github.com/siggy/bbox/pkg/tempo"
+	"github.com/siggy/bbox/pkg/watch"
 	"github.com/siggy/bbox/pkg/wavs"
+	"github.com/siggy/bbox/pkg/web"
 	log "github.com/sirupsen/logrus"
 )
 
-type programScheduler struct {
-	new    program.ProgramFactory
-	code   []int
-	hidden bool
-}
-
 const (
-	yieldLimit = 5 // number of yields repetition keys before switching programs
+	reloadInterval = 2 * time.Second
 )
 
 var (
 	// should match scorpio/code.py
 	// StripLengths = []int{30, 30, 10, 10, 10, 10, 10, 10}
 	stripLengths = []int{144, 144, 144, 144, 144, 144, 144, 144}
-
-	defaultSounds = [program.Rows]string{
-		"hihat-808.wav",
-		"kick-classic.wav",
-		"perc-808.wav",
-		"tom-808.wav",
-	}
-
-	// if 75% of beats are active, yield to the next program
-	defaultBeatLimit  = program.Rows * program.Cols * 3 / 4
-	oneThirdBeatLimit = program.Rows * program.Cols / 3
 )
 
 func main() {
 	logLevel := flag.String("log-level", "debug", "set log level (debug, info, warn, error, fatal, panic)")
 	bboxKB := flag.Bool("bbox-keyboard", true, "enable beatboxer keyboard")
 	fakeLEDs := flag.Bool("fake-leds", false, "enable fake LEDs")
+	simLEDs := flag.Bool("sim-leds", false, "render LEDs in the terminal")
 	macDevice := flag.Bool("mac-device", false, "connect to scorpio from a macbook (default is Raspberry Pi)")
+	configPath := flag.String("config", filepath.Join(os.Getenv("HOME"), "code", "bbox", "config", "programs.yaml"), "program roster")
+	statePath := flag.String("state", filepath.Join(os.Getenv("HOME"), ".bbox", "beats.json"), "where beat grids are saved across program switches and restarts")
+	httpAddr := flag.String("http", "", "serve a live visualizer on this address, e.g. :8080")
+	mic := flag.Bool("mic", false, "feed the equalizer from the USB mic, so songs visualize live music in the room, and beats programs with syncTempo follow its tempo")
+	midiDevice := flag.String("midi", "", "send beats programs as MIDI drum notes and clock to this raw MIDI device, e.g. /dev/snd/midiC1D0")
+	midiIn := flag.String("midi-in", "", "read presses, and the tempo of a MIDI clock master for beats programs with syncTempo, from this raw MIDI device, e.g. /dev/snd/midiC1D0")
+	midiInMap := flag.String("midi-in-map", midiin.MappingLaunchpad, "map --midi-in notes to buttons: launchpad, linear (from note 36), or a mapping file")
+	oscAddr := flag.String("osc", "", "listen for OSC presses and program changes on this UDP address, e.g. :9000")
+	record := flag.String("record", "", "record every press to this session file")
+	replay := flag.String("replay", "", "replay the presses in this session file")
+	replaySpeed := flag.Float64("replay-speed", 1, "speed up --replay by this factor, 0 for as fast as possible")
+	idleTimeout := flag.Duration("idle-timeout", 0, "move on to the next program after this long without presses, 0 to never")
+	transitionName := flag.String("transition", scheduler.TransitionCut.String(), "how to switch programs: cut, fade, wipe or sparkle")
+	transitionTime := flag.Duration("transition-time", time.Second, "how long a --transition other than cut blends programs and fades out their sounds")
 	flag.Parse()
 
 	lvl, err := log.ParseLevel(*logLevel)
@@ -76,8 +85,57 @@ func main() {
 	}
 	defer wavs.Close()
 
+	// tempos from the mic and the MIDI clock master
+	tempos := make(chan tempo.Tempo, program.ChannelBuffer)
+	if *mic {
+		wavs.UseMic()
+
+		detector := tempo.New(equalizer.SampleRate)
+		go forwardTempos(detector.Tempos(), tempos)
+
+		amp, err := amplitude.New(amplitude.WithSamples(equalizer.SampleRate, func(samples []float64) {
+			wavs.AddEQSamples(samples)
+			detector.AddSamples(samples)
+		}))
+		if err != nil {
+			log.Fatalf("amplitude.New failed: %v", err)
+		}
+		defer amp.Close()
+	}
+
+	store, err := beats.NewFileStore(*statePath)
+	if err != nil {
+		log.Fatalf("beats.NewFileStore failed: %v", err)
+	}
+
+	beatsOpts := []beats.Option{beats.WithStore(store)}
+	if *midiDevice != "" {
+		out, err := midi.Open(*midiDevice)
+		if err != nil {
+			log.Fatalf("midi.Open failed: %v", err)
+		}
+		defer out.Close()
+
+		beatsOpts = append(beatsOpts, beats.WithMIDI(out))
+	}
+
+	programs, err := loadPrograms(*configPath, wavs, wavs.Has, beatsOpts...)
+	if err != nil {
+		log.Fatalf("loadPrograms failed: %v", err)
+	}
+
+	// reload wavs and programs when they change on disk
+	watcher := watch.New(ctx, reloadInterval, wavPath, *configPath)
+	defer watcher.Close()
+
 	var ledStrips leds.LEDs
-	if *fakeLEDs {
+	if *simLEDs {
+		ledStrips, err = simulator.New(ctx, stripLengths, rows.BeatboxerLayout())
+		if err != nil {
+			log.Errorf("simulator.New failed: %+v", err)
+			os.Exit(1)
+		}
+	} else if *fakeLEDs {
 		ledStrips, err = leds.NewFake(stripLengths)
 		if err != nil {
 			log.Errorf("leds.NewFake failed: %+v", err)
@@ -90,6 +148,22 @@ func main() {
 			os.Exit(1)
 		}
 	}
+
+	// presses from every input device
+	inputs := input.NewMux()
+	defer inputs.Close()
+
+	var server *web.Server
+	if *httpAddr != "" {
+		webPresses := make(chan program.Coord, program.ChannelBuffer)
+		server, err = web.New(ctx, *httpAddr, rows.BeatboxerLayout(), webPresses)
+		if err != nil {
+			log.Errorf("web.New failed: %+v", err)
+			os.Exit(1)
+		}
+		ledStrips = leds.Multi(ledStrips, server)
+		inputs.Add(input.FromChan(input.Device{Kind: input.KindWeb, Name: *httpAddr}, webPresses, nil))
+	}
 	defer ledStrips.Close()
 	ledStrips.Clear()
 
@@ -97,247 +171,128 @@ func main() {
 	if err != nil {
 		log.Fatalf("keyboard.New failed: %v", err)
 	}
-	presses := keyboard.Presses()
 
 	go keyboard.Run()
+	go func() {
+		<-inputs.Add(keyboard)
 
-	// TODO: first program should not be marked hidden
-	programs := []programScheduler{
-		{
-			new: beats.New(
-				"default",
-				leds.Red, leds.White,
-				defaultSounds,
-				[]program.Coord{
-					{Row: 1, Col: 0},
-					{Row: 1, Col: 8},
-				},
-				120,
-				defaultBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		// We Will Rock You — Queen (thick: add kick under stomps)
-		{
-			new: beats.New(
-				"we will rock you",
-				leds.White, leds.Gold,
-				[program.Rows]string{
-					"clap-analog.wav",    // bright accent layer for clap
-					"kick-stomp.wav",     // stomp core
-					"clap-fat.wav",       // main clap
-					"tom-acoustic01.wav", // low tom for stomp layer
-				},
-				[]program.Coord{
-					// Stomps = kick + tom stacked
-					{Row: 1, Col: 0}, {Row: 3, Col: 0},
-					{Row: 1, Col: 4}, {Row: 3, Col: 4},
-
-					// Flam into the clap (slightly early) + bright layer
-					{Row: 2, Col: 9}, // main clap
-					{Row: 0, Col: 9}, // bright layer
-				},
-				165,
-				oneThirdBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		// Stayin’ Alive — Bee Gees (disco: four-on-the-floor + 8th hats)
-		{
-			new: beats.New(
-				"stayin alive",
-				leds.Red, leds.Mint,
-				[program.Rows]string{
-					"hihat-acoustic02.wav", // Row 0 - bright disco hihat
-					"kick-classic.wav",     // Row 1 - disco kick
-					"snare-big.wav",        // Row 2 - roomy snare
-					"openhat-tight.wav",    // Row 3 - open hihat accent
-				},
-				[]program.Coord{
-					// Hihat (8ths)
-					{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 0, Col: 4}, {Row: 0, Col: 6},
-					{Row: 0, Col: 8}, {Row: 0, Col: 10}, {Row: 0, Col: 12}, {Row: 0, Col: 14},
-					// Kick on all quarters
-					{Row: 1, Col: 0}, {Row: 1, Col: 4}, {Row: 1, Col: 8}, {Row: 1, Col: 12},
-					// Snare on 2 & 4
-					{Row: 2, Col: 4}, {Row: 2, Col: 12},
-				},
-				104,
-				oneThirdBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		// Shape of You — Ed Sheeran (tight pop groove)
-		{
-			new: beats.New(
-				"shape of you",
-				leds.Orange, leds.Cyan,
-				[program.Rows]string{
-					"hihat-acoustic02.wav", // Row 0 - clean hihat
-					"kick-classic.wav",     // Row 1 - main kick
-					"snare-acoustic02.wav", // Row 2 - snare/clap blend
-					"perc-tambo.wav",       // Row 3 - tambourine accent
-				},
-				[]program.Coord{
-					// Hihat (8ths)
-					{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 0, Col: 4}, {Row: 0, Col: 6},
-					{Row: 0, Col: 8}, {Row: 0, Col: 10}, {Row: 0, Col: 12}, {Row: 0, Col: 14},
-					// Kick
-					{Row: 1, Col: 0}, {Row: 1, Col: 8}, {Row: 1, Col: 11},
-					// Snare
-					{Row: 2, Col: 4}, {Row: 2, Col: 12},
-				},
-				96,
-				oneThirdBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		// Four-on-the-floor (house)
-		{
-			new: beats.New(
-				"four on the floor",
-				leds.Red, leds.White,
-				[program.Rows]string{
-					"hihat-analog.wav",  // Row 0 - tight closed hihat
-					"kick-classic.wav",  // Row 1 - punchy house kick
-					"clap-808.wav",      // Row 2 - snappy clap/snare
-					"openhat-tight.wav", // Row 3 - short open hihat
-				},
-				[]program.Coord{
-					// Hihat (8ths)
-					{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 0, Col: 4}, {Row: 0, Col: 6},
-					{Row: 0, Col: 8}, {Row: 0, Col: 10}, {Row: 0, Col: 12}, {Row: 0, Col: 14},
-					// Kick
-					{Row: 1, Col: 0}, {Row: 1, Col: 8},
-					// Snare-ish (perc)
-					{Row: 2, Col: 4}, {Row: 2, Col: 12},
-				},
-				124,
-				oneThirdBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		// Dembow / reggaeton
-		{
-			new: beats.New(
-				"dembow",
-				leds.Yellow, leds.Cyan,
-				[program.Rows]string{
-					"hihat-acoustic01.wav", // Row 0 - bright hat
-					"kick-classic.wav",     // Row 1 - punchy kick
-					"snare-analog.wav",     // Row 2 - rimshot/snare tone
-					"perc-tambo.wav",       // Row 3 - tambourine accent
-				},
-				[]program.Coord{
-					// Hihat (8ths)
-					{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 0, Col: 4}, {Row: 0, Col: 6},
-					{Row: 0, Col: 8}, {Row: 0, Col: 10}, {Row: 0, Col: 12}, {Row: 0, Col: 14},
-					// Kick
-					{Row: 1, Col: 0}, {Row: 1, Col: 8},
-					// Snare-ish (perc)
-					{Row: 2, Col: 4}, {Row: 2, Col: 10},
-				},
-				100,
-				oneThirdBeatLimit,
-			),
-			code: nil, hidden: false,
-		},
-
-		{new: song.New("wouldnt_it_be_nice.wav", time.Second*154), code: []int{1, 2, 1, 0}, hidden: true},
-		{new: song.New("runnin_with_the_devil.wav", time.Second*215), code: []int{0, 9, 1, 7}, hidden: true},
-		{new: song.New("pyramid.wav", time.Second*289), code: []int{0, 6, 0, 4}, hidden: true},
-		{new: song.New("black_sabbath.wav", time.Second*378), code: []int{0, 4, 2, 0}, hidden: true},
-	}
+		log.Info("keyboard channel closed, exiting...")
+		stop()
+	}()
 
-	cur := 0
-	progCtx, cancelProg := context.WithCancel(ctx)
-	curProgram := programs[cur].new(progCtx)
+	if *midiIn != "" {
+		mapping, err := midiin.LoadMapping(*midiInMap)
+		if err != nil {
+			log.Fatalf("midiin.LoadMapping failed: %v", err)
+		}
 
-	yieldCount := 0
+		pads, err := midiin.Open(*midiIn, mapping)
+		if err != nil {
+			log.Fatalf("midiin.Open failed: %v", err)
+		}
 
-	rollingCode := []int{0, 0, 0, 0}
+		go pads.Run()
+		go forwardTempos(pads.Tempos(), tempos)
+		inputs.Add(pads)
+	}
 
-	for {
-		yield := func(next program.ProgramFactory) {
-			log.Debugf("yield prev program: %s", curProgram.Name())
-
-			cancelProg()
-			curProgram.Close()
-
-			if next == nil {
-				for {
-					cur = (cur + 1) % len(programs)
-					if !programs[cur].hidden {
-						break
-					}
-				}
+	if *replay != "" {
+		session, err := input.NewReplay(*replay, *replaySpeed)
+		if err != nil {
+			log.Fatalf("input.NewReplay failed: %v", err)
+		}
+		inputs.Add(session)
+	}
 
-				next = programs[cur].new
-			} else {
-				// back next up one so we yield back to the same place
-				cur = (cur - 1 + len(programs)) % len(programs)
-			}
+	// recorder stays nil without --record
+	var recorder *input.Recorder
+	if *record != "" {
+		recorder, err = input.NewRecorder(*record)
+		if err != nil {
+			log.Fatalf("input.NewRecorder failed: %v", err)
+		}
+		defer recorder.Close()
+	}
 
-			progCtx, cancelProg = context.WithCancel(ctx)
-			curProgram = next(progCtx)
+	// programCommands stays nil without OSC
+	var programCommands <-chan string
+	if *oscAddr != "" {
+		server, err := osc.New(*oscAddr)
+		if err != nil {
+			log.Fatalf("osc.New failed: %v", err)
+		}
 
-			ledStrips.Clear()
-			wavs.StopAll()
-			yieldCount = 0
+		programCommands = server.Programs()
+		inputs.Add(server)
+	}
 
-			log.Debugf("yield new program: %s", curProgram.Name())
-		}
+	transition, err := scheduler.ParseTransition(*transitionName)
+	if err != nil {
+		log.Fatalf("scheduler.ParseTransition failed: %v", err)
+	}
 
-		select {
-		case press, ok := <-presses:
-			if !ok {
-				log.Info("keyboard channel closed, exiting...")
+	// a cut stops every sound and clears the LEDs at once, other transitions
+	// fade them out
+	fadeTime := *transitionTime
+	if transition == scheduler.TransitionCut {
+		fadeTime = 0
+	}
 
-				cancelProg()
-				curProgram.Close()
-				return
+	sched, err := scheduler.New(ctx, programs,
+		scheduler.WithIdleTimeout(*idleTimeout),
+		scheduler.WithTransition(transition, fadeTime),
+		// stop or fade out sounds before the next program starts, songs play
+		// as soon as they start
+		scheduler.OnExit(func(program.Program, scheduler.Reason) {
+			wavs.FadeOut(fadeTime)
+		}),
+		scheduler.OnEnter(func(program.Program, scheduler.Reason) {
+			if fadeTime == 0 {
+				ledStrips.Clear()
 			}
+		}),
+	)
+	if err != nil {
+		log.Fatalf("scheduler.New failed: %v", err)
+	}
+	sched.Start()
 
-			log.Debugf("press: %q", press)
+	for {
+		curProgram := sched.Current()
+		// outProgram never renders or plays unless transitioning
+		outProgram := sched.Outgoing()
 
-			// TODO: combine these two code patterns?
-			if press.Col == program.Cols-1 && press.Row == program.Rows-1 {
-				yieldCount++
-				log.Debugf("yieldCount: %d", yieldCount)
-				if yieldCount >= yieldLimit {
-					yield(nil)
-					continue
-				}
-			} else {
-				yieldCount = 0
+		select {
+		case press := <-inputs.Presses():
+			log.Debugf("press: %+v from %s", press.Coord, press.Device)
+
+			if recorder != nil {
+				recorder.Record(press)
 			}
 
-			if press.Row == 0 {
-				rollingCode = append(rollingCode[1:], press.Col)
+			sched.Press(press)
 
-				var found program.ProgramFactory
+		case command, ok := <-programCommands:
+			if !ok {
+				programCommands = nil
+				continue
+			}
+			log.Debugf("program command: %s", command)
 
-				for _, p := range programs {
-					if slices.Equal(p.code, rollingCode) {
-						log.Debugf("rolling code matched: %v", rollingCode)
-						found = p.new
-						break
-					}
-				}
+			if command == osc.ProgramNext {
+				sched.Next(scheduler.ReasonCommand)
+				continue
+			}
 
-				if found != nil {
-					yield(found)
-				}
-			} else {
-				rollingCode = []int{0, 0, 0, 0}
+			if err := sched.Switch(command, scheduler.ReasonCommand); err != nil {
+				log.Warnf("switch failed: %v", err)
 			}
 
-			curProgram.Press(press)
+		case <-sched.Idle():
+			sched.Next(scheduler.ReasonTimeout)
+
+		case event := <-sched.Events():
+			log.Infof("program: %s -> %s (%s)", event.From, event.To, event.Reason)
 
 		case displayData, ok := <-wavs.EQ():
 			if !ok {
@@ -346,31 +301,120 @@ func main() {
 			}
 
 			curProgram.EQ(displayData)
+			outProgram.EQ(displayData)
 
 		case leds := <-curProgram.Render():
 			log.Tracef("leds: %s", leds)
 
-			ledStrips.Set(leds)
+			ledStrips.Set(sched.Render(leds))
+
+			if server != nil {
+				if p, ok := curProgram.(program.GridProgram); ok {
+					grid := p.Grid()
+					server.SetGrid(&grid)
+				} else {
+					server.SetGrid(nil)
+				}
+			}
+
+		case leds := <-outProgram.Render():
+			log.Tracef("outgoing leds: %s", leds)
+
+			ledStrips.Set(sched.RenderOutgoing(leds))
+
+		case <-sched.Frames():
+			ledStrips.Set(sched.Frame())
+
+		case t := <-tempos:
+			log.Tracef("tempo: %+v", t)
+
+			if tp, ok := curProgram.(program.TempoProgram); ok {
+				tp.SyncTempo(t.BPM, t.Beat)
+			}
 
 		case play := <-curProgram.Play():
-			log.Tracef("play: %s", play)
+			log.Tracef("play: %+v", play)
+
+			wavs.PlaySound(play)
+
+		case play := <-outProgram.Play():
+			log.Tracef("outgoing play: %+v", play)
 
-			wavs.Play(play)
+			play.Gain *= 1 - sched.Progress()
+			wavs.PlaySound(play)
 
 		case play := <-curProgram.PlayWithEQ():
 			log.Tracef("play with eq: %s", play)
 
 			wavs.PlayWithEQ(play)
 
+		case path := <-watcher.Changes():
+			log.Infof("changed on disk: %s", path)
+
+			// check programs against the new wavs before using either, so a
+			// bad change to one keeps both as they were
+			has := wavs.Has
+			use := func() {}
+			if path == wavPath {
+				library, err := wavs.Load()
+				if err != nil {
+					log.Errorf("wavs.Load failed, keeping previous wavs and programs: %v", err)
+					continue
+				}
+				has = library.Has
+				use = func() { wavs.Use(library) }
+			}
+
+			// reload programs either way, new wavs may be referenced
+			reloaded, err := loadPrograms(*configPath, wavs, has, beatsOpts...)
+			if err != nil {
+				log.Errorf("loadPrograms failed, keeping previous wavs and programs: %v", err)
+				continue
+			}
+			if err := sched.SetEntries(reloaded); err != nil {
+				log.Errorf("SetEntries failed, keeping previous wavs and programs: %v", err)
+				continue
+			}
+			use()
+
 		case <-curProgram.Yield():
-			yield(nil)
+			sched.Next(scheduler.ReasonProgramYield)
 
 		case <-ctx.Done():
 			log.Info("context done")
 
-			cancelProg()
-			curProgram.Close()
+			sched.Close()
 			return
 		}
 	}
 }
+
+// forwardTempos forwards tempos from a source, dropping them if out is full.
+func forwardTempos(in <-chan tempo.Tempo, out chan<- tempo.Tempo) {
+	for t := range in {
+		select {
+		case out <- t:
+		default:
+		}
+	}
+}
+
+// loadPrograms reads the program roster, and checks every wav it references
+// exists with has. Songs and playlists play from w, and beats programs get
+// beatsOpts.
+func loadPrograms(path string, w *wavs.Wavs, has func(string) bool, beatsOpts ...beats.Option) ([]scheduler.Entry, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(has); err != nil {
+		return nil, err
+	}
+
+	programs := []scheduler.Entry{}
+	for _, p := range cfg.Programs {
+		programs = append(programs, scheduler.Entry{Name: p.Name, New: p.Factory(w, beatsOpts...), Code: p.Code, Hidden: p.Hidden})
+	}
+
+	return programs, nil
+}
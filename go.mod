@@ -8,6 +8,9 @@ require (
 	github.com/gen2brain/malgo v0.11.23
 	github.com/gordonklaus/portaudio v0.0.0-20250206071425-98a94950218b
 	github.com/gorilla/websocket v1.5.3
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/jfreymuth/oggvorbis v1.0.5
+	github.com/mewkiz/flac v1.0.14
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	github.com/nsf/termbox-go v1.1.1
 	github.com/siggy/rpi_ws281x v0.0.0-20180421091134-f0614f8b2ecf
@@ -15,13 +18,18 @@ require (
 	github.com/stianeikeland/go-rpio v4.2.0+incompatible
 	github.com/youpy/go-wav v0.3.2
 	go.bug.st/serial v1.6.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
 	github.com/ebitengine/purego v0.8.0 // indirect
 	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/icza/bitio v1.1.0 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
+	github.com/mewkiz/pkg v0.0.0-20250417130911-3f050ff8c56d // indirect
+	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
 	github.com/youpy/go-riff v0.1.0 // indirect
 	github.com/zaf/g711 v0.0.0-20190814101024-76a4a538f52b // indirect
 	golang.org/x/sys v0.25.0 // indirect
@@ -10,10 +10,19 @@ import (
 	"time"
 
 	"github.com/gen2brain/malgo"
+	"github.com/siggy/bbox/pkg/resample"
 	log "github.com/sirupsen/logrus"
 )
 
-const channelBuffer = 100
+const (
+	channelBuffer = 100
+
+	// SampleRate is requested from the device, USB codecs prefer 48k
+	SampleRate = 48000
+)
+
+// Option configures optional capture behavior.
+type Option func(*Amplitude)
 
 type Amplitude struct {
 	ctx    *malgo.AllocatedContext
@@ -25,6 +34,21 @@ type Amplitude struct {
 	lastNanos       int64                 // last time we saw audio
 	mu              sync.Mutex            // guards device (stop/uninit/reinit)
 	log             *log.Entry
+
+	// samples receives raw captured audio, see WithSamples
+	samples   func([]float64)
+	resampler *resample.Stream
+	captured  []float32
+}
+
+// WithSamples passes the raw captured audio to samples, resampled to rate, in
+// addition to computing levels. For example, to feed an equalizer from the
+// mic.
+func WithSamples(rate int, samples func([]float64)) Option {
+	return func(a *Amplitude) {
+		a.samples = samples
+		a.resampler = resample.New(SampleRate, rate).Stream()
+	}
 }
 
 func (a *Amplitude) Level() <-chan float64 {
@@ -38,11 +62,24 @@ func (a *Amplitude) onRecvFrames(_, in []byte, _ uint32) {
 	atomic.StoreInt64(&a.lastNanos, time.Now().UnixNano())
 
 	var sum float64
+	a.captured = a.captured[:0]
 	// S16 mono LE: 2 bytes per sample
 	for i := 0; i < len(in)-1; i += 2 {
 		s := int16(binary.LittleEndian.Uint16(in[i:]))
 		f := float64(s) / 32768.0 // [-1,1]
 		sum += math.Abs(f)
+		if a.samples != nil {
+			a.captured = append(a.captured, float32(f))
+		}
+	}
+
+	if a.samples != nil {
+		resampled := a.resampler.Process(a.captured, false)
+		samples := make([]float64, len(resampled))
+		for i, sample := range resampled {
+			samples[i] = float64(sample)
+		}
+		a.samples(samples)
 	}
 
 	n := float64(len(in) / 2) // number of samples
@@ -61,7 +98,7 @@ func (a *Amplitude) onRecvFrames(_, in []byte, _ uint32) {
 	}
 }
 
-func New() (*Amplitude, error) {
+func New(opts ...Option) (*Amplitude, error) {
 	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create malgo context: %w", err)
@@ -72,11 +109,14 @@ func New() (*Amplitude, error) {
 		levels: make(chan float64, channelBuffer),
 		log:    log.WithField("bbox", "amplitude"),
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
 
 	a.deviceConfig = malgo.DefaultDeviceConfig(malgo.Capture)
 	a.deviceConfig.Capture.Format = malgo.FormatS16
 	a.deviceConfig.Capture.Channels = 1
-	a.deviceConfig.SampleRate = 48000 // prefer 48k for USB codecs
+	a.deviceConfig.SampleRate = SampleRate
 
 	a.deviceCallbacks = malgo.DeviceCallbacks{
 		Data: a.onRecvFrames,
@@ -0,0 +1,71 @@
+// Package clock abstracts the time package, so timing code can run on virtual
+// time, see Fake.
+package clock
+
+import "time"
+
+type (
+	// Clock tells the time and makes timers.
+	Clock interface {
+		Now() time.Time
+		Since(t time.Time) time.Duration
+		Until(t time.Time) time.Duration
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
+		// AfterFunc calls f after d, its Timer's C is nil
+		AfterFunc(d time.Duration, f func()) Timer
+	}
+
+	// Timer is a time.Timer.
+	Timer interface {
+		C() <-chan time.Time
+		Stop() bool
+		Reset(d time.Duration) bool
+	}
+
+	// Ticker is a time.Ticker.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+		Reset(d time.Duration)
+	}
+
+	realClock  struct{}
+	realTimer  struct{ *time.Timer }
+	realTicker struct{ *time.Ticker }
+)
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) Until(t time.Time) time.Duration {
+	return time.Until(t)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
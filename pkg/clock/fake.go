@@ -0,0 +1,188 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Fake is a Clock that only moves when told to, for tests. Timers fire in
+	// order of their deadlines as Advance passes them, and AfterFunc calls f
+	// before Advance returns.
+	Fake struct {
+		mu  sync.Mutex
+		now time.Time
+		// timers are the pending timers and tickers, by deadline, then by
+		// when they were set
+		timers []*fakeTimer
+	}
+
+	fakeTimer struct {
+		clock *Fake
+		c     chan time.Time
+		f     func()
+		at    time.Time
+		// period is non-zero for tickers
+		period time.Duration
+	}
+
+	fakeTicker struct {
+		*fakeTimer
+	}
+)
+
+// NewFake returns a Fake starting at start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1), period: d}
+	t.Reset(d)
+	return fakeTicker{t}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{clock: f, f: fn}
+	t.Reset(d)
+	return t
+}
+
+// Pending returns the number of timers and tickers waiting to fire, so tests
+// can wait for the code under test to set them before advancing.
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.timers)
+}
+
+// Advance moves the clock forward by d, firing every timer due on the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+
+	for len(f.timers) > 0 && !f.timers[0].at.After(end) {
+		t := f.timers[0]
+		f.timers = f.timers[1:]
+		f.now = t.at
+
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+			f.add(t)
+		}
+
+		if t.f != nil {
+			// f may use the clock
+			f.mu.Unlock()
+			t.f()
+			f.mu.Lock()
+			continue
+		}
+
+		// like time.Ticker, drop ticks nobody read
+		select {
+		case t.c <- f.now:
+		default:
+		}
+	}
+
+	f.now = end
+	f.mu.Unlock()
+}
+
+// add schedules t, f.mu must be held.
+func (f *Fake) add(t *fakeTimer) {
+	i := sort.Search(len(f.timers), func(i int) bool {
+		return f.timers[i].at.After(t.at)
+	})
+	f.timers = append(f.timers, nil)
+	copy(f.timers[i+1:], f.timers[i:])
+	f.timers[i] = t
+}
+
+// remove unschedules t, and reports whether it was pending. f.mu must be held.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, pending := range f.timers {
+		if pending == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	if t.f != nil {
+		return nil
+	}
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	return t.clock.remove(t)
+}
+
+// Reset reschedules the timer, or the ticker's period. Like time.Timer since
+// Go 1.23, a stale tick is discarded.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	pending := t.clock.remove(t)
+
+	if t.c != nil {
+		select {
+		case <-t.c:
+		default:
+		}
+	}
+
+	if t.period > 0 {
+		t.period = d
+	}
+	t.at = t.clock.now.Add(d)
+	t.clock.add(t)
+
+	return pending
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.fakeTimer.Reset(d)
+}
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/programs/beats"
+	"github.com/siggy/bbox/pkg/programs/playlist"
+	"github.com/siggy/bbox/pkg/programs/song"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Config declares the roster of programs cmd/bbox cycles through.
+	Config struct {
+		Programs []Program `yaml:"programs"`
+	}
+
+	// Program declares one entry in the roster. Fields not relevant to Type
+	// are ignored.
+	Program struct {
+		Type   string `yaml:"type"` // "beats", "song" or "playlist"
+		Name   string `yaml:"name"`
+		Code   []int  `yaml:"code"`   // rolling code on row 0 that unlocks this program
+		Hidden bool   `yaml:"hidden"` // only reachable via Code
+
+		// beats
+		BeatColor  Color     `yaml:"beatColor"`
+		PulseColor Color     `yaml:"pulseColor"`
+		Sounds     []string  `yaml:"sounds"` // one per row
+		Pan        []float64 `yaml:"pan"`    // optional, one per row, -1 (left) to 1 (right)
+		Choke      []int     `yaml:"choke"`  // optional, one choke group per row, 0 for none
+		Notes      []uint8   `yaml:"notes"`  // optional, one MIDI drum note per row, 0 guesses from the sound
+		Beats      []Beat    `yaml:"beats"`  // starter beats
+		BPM        int       `yaml:"bpm"`
+		BeatLimit  int       `yaml:"beatLimit"` // defaults to 75% of all steps
+
+		// pattern, see beats.Preset
+		Steps        int     `yaml:"steps"`        // defaults to 16
+		StepsPerBeat int     `yaml:"stepsPerBeat"` // defaults to 4
+		Swing        float64 `yaml:"swing"`        // 50-75, defaults to 50 (straight)
+		SyncTempo    bool    `yaml:"syncTempo"`    // follow the room's tempo with --mic, or MIDI clock with --midi-in
+
+		// timing, durations such as "90s" or "3m", see beats.Preset
+		Decay      time.Duration `yaml:"decay"`      // turn a beat off after this long, defaults to 3m
+		KeepAlive  time.Duration `yaml:"keepAlive"`  // add a beat after the grid is empty this long, defaults to 14m
+		TempoDecay time.Duration `yaml:"tempoDecay"` // revert a tempo change after this long, defaults to 3m
+
+		// song, played to the end of the file
+		Wav string `yaml:"wav"`
+
+		// playlist, songs followed by every song in dir
+		Songs   []string `yaml:"songs"`
+		Dir     string   `yaml:"dir"` // a directory in the wavs directory
+		Shuffle bool     `yaml:"shuffle"`
+	}
+
+	// Beat is a starter beat, Col is the step.
+	Beat struct {
+		Row   int   `yaml:"row"`
+		Col   int   `yaml:"col"`
+		Level Level `yaml:"level"` // soft, normal or accent, defaults to normal
+	}
+
+	// Level is a beats.Level, written as its name.
+	Level beats.Level
+
+	// Color is a leds.Color, written as a name ("red") or "r,g,b,w".
+	Color leds.Color
+)
+
+const (
+	TypeBeats    = "beats"
+	TypeSong     = "song"
+	TypePlaylist = "playlist"
+
+	codeLength = 4
+)
+
+var (
+	colors = map[string]leds.Color{
+		"black":      leds.Black,
+		"red":        leds.Red,
+		"white":      leds.White,
+		"trueBlue":   leds.TrueBlue,
+		"trueRed":    leds.TrueRed,
+		"trueWhite":  leds.TrueWhite,
+		"mint":       leds.Mint,
+		"deepPurple": leds.DeepPurple,
+		"orange":     leds.Orange,
+		"yellow":     leds.Yellow,
+		"cyan":       leds.Cyan,
+		"skyBlue":    leds.SkyBlue,
+		"gold":       leds.Gold,
+	}
+)
+
+// Load reads and checks a config file. It does not check that wavs exist, see
+// Validate.
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := cfg.check(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that every wav referenced by the config exists.
+func (c *Config) Validate(exists func(filename string) bool) error {
+	var errs []error
+	for _, p := range c.Programs {
+		for _, wav := range p.wavs() {
+			if !exists(wav) {
+				errs = append(errs, fmt.Errorf("program %q: wav not found: %s", p.Name, wav))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Factory returns a factory for the declared program. tracks only applies to
+// songs and playlists, and beatsOpts to beats programs.
+func (p Program) Factory(tracks program.Tracks, beatsOpts ...beats.Option) program.ProgramFactory {
+	switch p.Type {
+	case TypeSong:
+		return song.New(p.Wav, tracks)
+	case TypePlaylist:
+		return playlist.New(playlist.Playlist{Name: p.Name, Songs: p.Songs, Dir: p.Dir, Shuffle: p.Shuffle}, tracks)
+	default:
+		return beats.New(p.Preset(), beatsOpts...)
+	}
+}
+
+// Preset returns the beats preset declared by a beats program.
+func (p Program) Preset() beats.Preset {
+	starterBeats := make([]beats.Step, len(p.Beats))
+	for i, beat := range p.Beats {
+		starterBeats[i] = beats.Step{
+			Coord: program.Coord{Row: beat.Row, Col: beat.Col},
+			Level: beats.Level(beat.Level),
+		}
+	}
+
+	preset := beats.Preset{
+		Name:         p.Name,
+		BeatColor:    leds.Color(p.BeatColor),
+		PulseColor:   leds.Color(p.PulseColor),
+		Sounds:       [program.Rows]string(p.Sounds),
+		StarterBeats: starterBeats,
+		BPM:          p.BPM,
+		BeatLimit:    p.BeatLimit,
+		Steps:        p.Steps,
+		StepsPerBeat: p.StepsPerBeat,
+		Swing:        p.Swing,
+		SyncTempo:    p.SyncTempo,
+		Decay:        p.Decay,
+		KeepAlive:    p.KeepAlive,
+		TempoDecay:   p.TempoDecay,
+	}
+	copy(preset.Pan[:], p.Pan)
+	copy(preset.Choke[:], p.Choke)
+	copy(preset.Notes[:], p.Notes)
+
+	return preset
+}
+
+func (c *Config) check() error {
+	if len(c.Programs) == 0 {
+		return errors.New("no programs")
+	}
+	if c.Programs[0].Hidden {
+		return fmt.Errorf("first program %q must not be hidden", c.Programs[0].Name)
+	}
+
+	var errs []error
+	// names maps each program's name to its index, programs are switched to
+	// by name
+	names := map[string]int{}
+	for i, p := range c.Programs {
+		if first, ok := names[p.Name]; ok {
+			errs = append(errs, fmt.Errorf("program %d (%q): same name as program %d", i, p.Name, first))
+		} else {
+			names[p.Name] = i
+		}
+		if err := p.check(); err != nil {
+			errs = append(errs, fmt.Errorf("program %d (%q): %w", i, p.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p Program) check() error {
+	if p.Code != nil {
+		if len(p.Code) != codeLength {
+			return fmt.Errorf("code must be %d digits: %v", codeLength, p.Code)
+		}
+		for _, digit := range p.Code {
+			if digit < 0 || digit >= program.Cols {
+				return fmt.Errorf("code digit out of range: %d", digit)
+			}
+		}
+	}
+
+	switch p.Type {
+	case TypeBeats:
+		if len(p.Sounds) != program.Rows {
+			return fmt.Errorf("expected %d sounds, got %d", program.Rows, len(p.Sounds))
+		}
+		if p.Pan != nil && len(p.Pan) != program.Rows {
+			return fmt.Errorf("expected %d pans, got %d", program.Rows, len(p.Pan))
+		}
+		if p.Choke != nil && len(p.Choke) != program.Rows {
+			return fmt.Errorf("expected %d choke groups, got %d", program.Rows, len(p.Choke))
+		}
+		if p.Notes != nil && len(p.Notes) != program.Rows {
+			return fmt.Errorf("expected %d notes, got %d", program.Rows, len(p.Notes))
+		}
+		if err := p.Preset().Validate(); err != nil {
+			return err
+		}
+	case TypeSong:
+		if p.Wav == "" {
+			return errors.New("missing wav")
+		}
+	case TypePlaylist:
+		if len(p.Songs) == 0 && p.Dir == "" {
+			return errors.New("missing songs or dir")
+		}
+	default:
+		return fmt.Errorf("unknown type: %q", p.Type)
+	}
+
+	return nil
+}
+
+func (p Program) wavs() []string {
+	switch p.Type {
+	case TypeSong:
+		return []string{p.Wav}
+	case TypePlaylist:
+		// songs in dir are listed when the playlist starts
+		return p.Songs
+	}
+	return p.Sounds
+}
+
+func (c *Color) UnmarshalYAML(value *yaml.Node) error {
+	if color, ok := colors[value.Value]; ok {
+		*c = Color(color)
+		return nil
+	}
+
+	parts := strings.Split(value.Value, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("line %d: unknown color %q, expected a name or r,g,b,w", value.Line, value.Value)
+	}
+
+	var rgbw [4]uint8
+	for i, part := range parts {
+		v, err := strconv.ParseUint(strings.TrimSpace(part), 10, 8)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid color %q: %w", value.Line, value.Value, err)
+		}
+		rgbw[i] = uint8(v)
+	}
+
+	*c = Color{R: rgbw[0], G: rgbw[1], B: rgbw[2], W: rgbw[3]}
+	return nil
+}
+
+func (l *Level) UnmarshalYAML(value *yaml.Node) error {
+	level, err := beats.ParseLevel(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+
+	*l = Level(level)
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/mjibson/go-dsp/fft"
+	"github.com/siggy/bbox/pkg/clock"
 )
 
 // DisplayData  holds a history of the last four spectrum readings.
@@ -22,22 +23,37 @@ type Equalizer struct {
 	buf         []float64
 	displayData DisplayData // Stores the last 4 smoothed
 	quit        chan struct{}
+	clock       clock.Clock
 }
 
+// Option configures optional Equalizer behavior.
+type Option func(*Equalizer)
+
 const (
 	HistorySize     = 4
-	sampleRate      = 44100
+	SampleRate      = 44100 // the rate AddSamples expects
 	fftSize         = 1024
 	hopSize         = fftSize / 2 // 50% overlap
 	smoothingFactor = 0.6
 )
 
+// WithClock paces analysis on c instead of the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(eq *Equalizer) {
+		eq.clock = c
+	}
+}
+
 // New creates an Equalizer. The 'bands' argument is used for display resolution.
-func New(bands int) *Equalizer {
+func New(bands int, opts ...Option) *Equalizer {
 	eq := &Equalizer{
 		bands: bands,
 		data:  make(chan DisplayData, 1),
 		quit:  make(chan struct{}),
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(eq)
 	}
 	// Initialize history slices
 	for i := range HistorySize {
@@ -103,8 +119,8 @@ func (eq *Equalizer) loop() {
 	mags := make([]float64, fftSize/2)
 
 	// Pace by audio time: ~86.1 hops/sec for 44.1k, 1024/2.
-	hopDur := time.Second * time.Duration(hopSize) / time.Duration(sampleRate)
-	next := time.Now()
+	hopDur := time.Second * time.Duration(hopSize) / time.Duration(SampleRate)
+	next := eq.clock.Now()
 
 	for {
 		// Wait until we have enough for one frame (or we're told to quit).
@@ -161,11 +177,11 @@ func (eq *Equalizer) loop() {
 
 		// --- Pace to audio clock & cap latency if behind ---
 		next = next.Add(hopDur)
-		if d := time.Until(next); d > 0 {
+		if d := eq.clock.Until(next); d > 0 {
 			// Sleep (interruptible by quit).
-			timer := time.NewTimer(d)
+			timer := eq.clock.NewTimer(d)
 			select {
-			case <-timer.C:
+			case <-timer.C():
 			case <-eq.quit:
 				timer.Stop()
 				return
@@ -189,7 +205,7 @@ func (eq *Equalizer) loop() {
 				eq.buf = eq.buf[drop:]
 			}
 			eq.mu.Unlock()
-			next = time.Now()
+			next = eq.clock.Now()
 		}
 
 		// Allow quit between cycles.
@@ -237,7 +253,7 @@ func normalizeSpectrum(dbSpectrum []float64) []float64 {
 // Calculates the spectrum energy in dB for log-spaced frequency bands.
 func calculateLogSpectrum(mags []float64, numBands int) []float64 {
 	spectrum := make([]float64, numBands)
-	maxFreq := float64(sampleRate) / 2.0
+	maxFreq := float64(SampleRate) / 2.0
 	binWidth := maxFreq / float64(len(mags))
 
 	// Define the logarithmic frequency boundaries
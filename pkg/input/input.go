@@ -0,0 +1,169 @@
+// Package input merges presses from every device that can press the buttons,
+// such as the box's keyboards, MIDI pads, the web visualizer, OSC and replays,
+// and tags each press with its device.
+package input
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/siggy/bbox/pkg/program"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Device describes a source of presses.
+	Device struct {
+		// Kind is the type of device, e.g. KindKeyboard
+		Kind string
+		// Name tells devices of the same kind apart, e.g. a MIDI port
+		Name string
+	}
+
+	// Source is a device that presses buttons. Presses closes when the device
+	// goes away.
+	Source interface {
+		Device() Device
+		Presses() <-chan program.Coord
+		Close() error
+	}
+
+	// Press is a button press, and the device it came from.
+	Press struct {
+		program.Coord
+		Device Device
+	}
+
+	// Mux merges presses from several sources.
+	Mux struct {
+		presses chan Press
+		quit    chan struct{}
+		once    sync.Once
+
+		mu      sync.Mutex
+		sources []Source
+		wg      sync.WaitGroup
+
+		log *log.Entry
+	}
+
+	// chanSource is a Source backed by a channel, for devices that send
+	// presses to a channel they are given
+	chanSource struct {
+		device  Device
+		presses <-chan program.Coord
+		close   func() error
+	}
+)
+
+const (
+	KindKeyboard = "keyboard"
+	KindMIDI     = "midi"
+	KindWeb      = "web"
+	KindOSC      = "osc"
+	KindReplay   = "replay"
+)
+
+func (d Device) String() string {
+	if d.Name == "" || d.Name == d.Kind {
+		return d.Kind
+	}
+	return fmt.Sprintf("%s(%s)", d.Kind, d.Name)
+}
+
+// NewMux returns an empty Mux, see Add.
+func NewMux() *Mux {
+	return &Mux{
+		presses: make(chan Press, program.ChannelBuffer),
+		quit:    make(chan struct{}),
+		log:     log.WithField("bbox", "input"),
+	}
+}
+
+// Presses receives presses from every source added.
+func (m *Mux) Presses() <-chan Press {
+	return m.presses
+}
+
+// Add forwards presses from src until it closes, or the Mux does. The returned
+// channel closes when forwarding stops.
+func (m *Mux) Add(src Source) <-chan struct{} {
+	m.mu.Lock()
+	m.sources = append(m.sources, src)
+	m.mu.Unlock()
+
+	device := src.Device()
+	m.log.Infof("Added %s", device)
+
+	done := make(chan struct{})
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer close(done)
+
+		for {
+			select {
+			case <-m.quit:
+				return
+
+			case press, ok := <-src.Presses():
+				if !ok {
+					m.log.Infof("%s closed", device)
+					return
+				}
+
+				select {
+				case m.presses <- Press{Coord: press, Device: device}:
+				case <-m.quit:
+					return
+				}
+			}
+		}
+	}()
+
+	return done
+}
+
+// Close closes every source.
+func (m *Mux) Close() error {
+	m.once.Do(func() {
+		close(m.quit)
+	})
+	m.wg.Wait()
+
+	m.mu.Lock()
+	sources := m.sources
+	m.sources = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for _, src := range sources {
+		if err := src.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", src.Device(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// FromChan is a Source for a device that sends presses to a channel, e.g. the
+// web visualizer. close may be nil.
+func FromChan(device Device, presses <-chan program.Coord, close func() error) Source {
+	return &chanSource{device: device, presses: presses, close: close}
+}
+
+func (c *chanSource) Device() Device {
+	return c.device
+}
+
+func (c *chanSource) Presses() <-chan program.Coord {
+	return c.presses
+}
+
+func (c *chanSource) Close() error {
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
@@ -0,0 +1,236 @@
+package input
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/program"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Event is a press in a session file, one JSON object per line.
+	Event struct {
+		// At is the time since the session started, from the monotonic clock
+		At     time.Duration `json:"at"`
+		Row    int           `json:"row"`
+		Col    int           `json:"col"`
+		Device string        `json:"device,omitempty"`
+	}
+
+	// Recorder writes presses to a session file.
+	Recorder struct {
+		mu    sync.Mutex
+		f     *os.File
+		w     *bufio.Writer
+		clock clock.Clock
+		start time.Time
+
+		log *log.Entry
+	}
+
+	// Replay is a Source that plays back a session file. Presses closes at the
+	// end of the session.
+	Replay struct {
+		path  string
+		speed float64
+		clock clock.Clock
+
+		presses chan program.Coord
+		quit    chan struct{}
+		once    sync.Once
+		wg      sync.WaitGroup
+
+		log *log.Entry
+	}
+
+	// SessionOption configures a Recorder or Replay.
+	SessionOption func(*sessionOptions)
+
+	sessionOptions struct {
+		clock clock.Clock
+	}
+)
+
+// WithClock times the session on c instead of the system clock.
+func WithClock(c clock.Clock) SessionOption {
+	return func(o *sessionOptions) {
+		o.clock = c
+	}
+}
+
+// NewRecorder creates a session file at path, its clock starts now.
+func NewRecorder(path string, opts ...SessionOption) (*Recorder, error) {
+	o := newSessionOptions(opts)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return &Recorder{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		clock: o.clock,
+		start: o.clock.Now(),
+		log:   log.WithField("bbox", "recorder"),
+	}, nil
+}
+
+// Record appends a press. Each press is flushed, so a crash loses nothing.
+func (r *Recorder) Record(press Press) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.Marshal(Event{
+		At:     r.clock.Since(r.start),
+		Row:    press.Row,
+		Col:    press.Col,
+		Device: press.Device.String(),
+	})
+	if err != nil {
+		r.log.Errorf("Marshal failed: %v", err)
+		return
+	}
+
+	r.w.Write(b)
+	r.w.WriteByte('\n')
+	if err := r.w.Flush(); err != nil {
+		r.log.Errorf("Flush failed: %v", err)
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// ReadSession reads every event in a session file.
+func ReadSession(r io.Reader) ([]Event, error) {
+	var events []Event
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if event.Row < 0 || event.Row >= program.Rows || event.Col < 0 || event.Col >= program.Cols {
+			return nil, fmt.Errorf("line %d: press out of range: %d,%d", line, event.Row, event.Col)
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+// NewReplay plays back the session file at path, starting now. speed scales
+// time, e.g. 2 replays twice as fast, and 0 as fast as presses are read.
+func NewReplay(path string, speed float64, opts ...SessionOption) (*Replay, error) {
+	o := newSessionOptions(opts)
+
+	if speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed: %v", speed)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer f.Close()
+
+	events, err := ReadSession(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", path, err)
+	}
+
+	r := &Replay{
+		path:  path,
+		speed: speed,
+		clock: o.clock,
+
+		presses: make(chan program.Coord),
+		quit:    make(chan struct{}),
+
+		log: log.WithField("bbox", "replay"),
+	}
+
+	r.wg.Add(1)
+	go r.run(events)
+
+	return r, nil
+}
+
+func (r *Replay) Device() Device {
+	return Device{Kind: KindReplay, Name: r.path}
+}
+
+func (r *Replay) Presses() <-chan program.Coord {
+	return r.presses
+}
+
+// Close stops the replay.
+func (r *Replay) Close() error {
+	r.once.Do(func() {
+		close(r.quit)
+	})
+	r.wg.Wait()
+	return nil
+}
+
+func (r *Replay) run(events []Event) {
+	defer r.wg.Done()
+	defer close(r.presses)
+
+	r.log.Infof("Replaying %d presses from %s", len(events), r.path)
+
+	start := r.clock.Now()
+
+	for _, event := range events {
+		if r.speed > 0 {
+			at := start.Add(time.Duration(float64(event.At) / r.speed))
+			timer := r.clock.NewTimer(r.clock.Until(at))
+
+			select {
+			case <-timer.C():
+			case <-r.quit:
+				timer.Stop()
+				return
+			}
+		}
+
+		// unlike live devices, a replay waits for each press to be taken,
+		// so none are dropped
+		select {
+		case r.presses <- program.Coord{Row: event.Row, Col: event.Col}:
+		case <-r.quit:
+			return
+		}
+	}
+
+	r.log.Info("Replay finished")
+}
+
+func newSessionOptions(opts []SessionOption) sessionOptions {
+	o := sessionOptions{clock: clock.Real}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
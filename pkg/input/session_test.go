@@ -0,0 +1,124 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/program"
+)
+
+func TestSession(t *testing.T) {
+	keyboard := Device{Kind: KindKeyboard, Name: "keyboard"}
+	presses := []struct {
+		after time.Duration
+		coord program.Coord
+	}{
+		{100 * time.Millisecond, program.Coord{Row: 0, Col: 1}},
+		{250 * time.Millisecond, program.Coord{Row: 1, Col: 2}},
+		// two presses at once, e.g. from different devices
+		{0, program.Coord{Row: 2, Col: 3}},
+		{2 * time.Second, program.Coord{Row: program.Rows - 1, Col: program.Cols - 1}},
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	fake := clock.NewFake(time.Unix(0, 0))
+	recorder, err := NewRecorder(path, WithClock(fake))
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	for _, press := range presses {
+		fake.Advance(press.after)
+		recorder.Record(Press{Coord: press.coord, Device: keyboard})
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	events, err := ReadSession(f)
+	if err != nil {
+		t.Fatalf("ReadSession failed: %v", err)
+	}
+	if len(events) != len(presses) {
+		t.Fatalf("read %d events, want %d", len(events), len(presses))
+	}
+
+	var at time.Duration
+	for i, press := range presses {
+		at += press.after
+		want := Event{At: at, Row: press.coord.Row, Col: press.coord.Col, Device: keyboard.String()}
+		if events[i] != want {
+			t.Errorf("event %d is %+v, want %+v", i, events[i], want)
+		}
+	}
+
+	for _, speed := range []float64{1, 2, 0.5} {
+		t.Run(fmt.Sprintf("replay at %vx", speed), func(t *testing.T) {
+			fake := clock.NewFake(time.Unix(0, 0))
+			replay, err := NewReplay(path, speed, WithClock(fake))
+			if err != nil {
+				t.Fatalf("NewReplay failed: %v", err)
+			}
+			defer replay.Close()
+
+			var elapsed time.Duration
+			for i, event := range events {
+				// the replay waits on a timer for each press
+				waitFor(t, func() bool { return fake.Pending() == 1 })
+
+				wait := time.Duration(float64(event.At)/speed) - elapsed
+				if wait > 0 {
+					fake.Advance(wait - 1)
+					select {
+					case press := <-replay.Presses():
+						t.Fatalf("press %d %+v replayed early", i, press)
+					case <-time.After(10 * time.Millisecond):
+					}
+					fake.Advance(1)
+				} else {
+					fake.Advance(0)
+				}
+				elapsed += wait
+
+				select {
+				case press := <-replay.Presses():
+					if want := (program.Coord{Row: event.Row, Col: event.Col}); press != want {
+						t.Errorf("press %d is %+v, want %+v", i, press, want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("press %d not replayed", i)
+				}
+			}
+
+			select {
+			case _, ok := <-replay.Presses():
+				if ok {
+					t.Error("replayed a press after the session ended")
+				}
+			case <-time.After(time.Second):
+				t.Error("presses not closed at the end of the session")
+			}
+		})
+	}
+}
+
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !done(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
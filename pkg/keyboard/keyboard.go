@@ -2,6 +2,7 @@ package keyboard
 
 import (
 	"github.com/eiannone/keyboard"
+	"github.com/siggy/bbox/pkg/input"
 	"github.com/siggy/bbox/pkg/program"
 	log "github.com/sirupsen/logrus"
 )
@@ -37,10 +38,19 @@ func New(keymaps map[rune]program.Coord) (*Keyboard, error) {
 	}, nil
 }
 
+func (k *Keyboard) Device() input.Device {
+	return input.Device{Kind: input.KindKeyboard}
+}
+
 func (k *Keyboard) Presses() <-chan program.Coord {
 	return k.presses
 }
 
+// Close releases the terminal, ending Run.
+func (k *Keyboard) Close() error {
+	return keyboard.Close()
+}
+
 func (k *Keyboard) Run() {
 	defer func() {
 		keyboard.Close()
@@ -48,8 +58,8 @@ func (k *Keyboard) Run() {
 	}()
 
 	for {
-		event := <-k.keyEvents
-		if event.Err != nil {
+		event, ok := <-k.keyEvents
+		if !ok || event.Err != nil {
 			return
 		}
 		k.log.Debugf("You pressed: rune %q, key %X", event.Rune, event.Key)
@@ -85,6 +85,22 @@ func PulseColor(c Color, brightness float64) Color {
 	}
 }
 
+// Mix returns the color t of the way from a to b, t between 0 and 1.
+func Mix(a, b Color, t float64) Color {
+	if t <= 0 {
+		return a
+	} else if t >= 1 {
+		return b
+	}
+
+	return Color{
+		R: uint8(float64(a.R)*(1-t) + float64(b.R)*t),
+		G: uint8(float64(a.G)*(1-t) + float64(b.G)*t),
+		B: uint8(float64(a.B)*(1-t) + float64(b.B)*t),
+		W: uint8(float64(a.W)*(1-t) + float64(b.W)*t),
+	}
+}
+
 func (c Color) String() string {
 	return fmt.Sprintf("%d,%d,%d,%d", c.R, c.G, c.B, c.W)
 }
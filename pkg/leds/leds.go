@@ -3,9 +3,11 @@ package leds
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
+	"github.com/siggy/bbox/pkg/clock"
 	log "github.com/sirupsen/logrus"
 	"go.bug.st/serial"
 )
@@ -23,10 +25,14 @@ type (
 		wg     sync.WaitGroup
 
 		set          chan State
-		port         serial.Port
+		port         io.WriteCloser
 		stripLengths []int
+		clock        clock.Clock
 		log          *log.Entry
 	}
+
+	// Option configures optional LEDs behavior.
+	Option func(*leds)
 )
 
 const (
@@ -40,7 +46,14 @@ const (
 	reconcileInterval = 60 * time.Second
 )
 
-func New(ctx context.Context, stripLengths []int, macDevice bool) (LEDs, error) {
+// WithClock paces writes on c instead of the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(l *leds) {
+		l.clock = c
+	}
+}
+
+func New(ctx context.Context, stripLengths []int, macDevice bool, opts ...Option) (LEDs, error) {
 	devicePath := piDevicePath
 	if macDevice {
 		devicePath = macDevicePath
@@ -55,6 +68,16 @@ func New(ctx context.Context, stripLengths []int, macDevice bool) (LEDs, error)
 
 	log.Infof("Connected to %s", devicePath)
 
+	return newLEDs(ctx, port, stripLengths, log, opts...), nil
+}
+
+// NewWriter drives LEDs through any packet sink speaking the SCORPIO
+// protocol, such as a simulator, with the same diff/reconcile loop as New.
+func NewWriter(ctx context.Context, w io.WriteCloser, stripLengths []int, opts ...Option) LEDs {
+	return newLEDs(ctx, w, stripLengths, log.WithField("leds", "writer"), opts...)
+}
+
+func newLEDs(ctx context.Context, port io.WriteCloser, stripLengths []int, log *log.Entry, opts ...Option) *leds {
 	ctx, cancel := context.WithCancel(ctx)
 	l := &leds{
 		ctx:    ctx,
@@ -63,13 +86,17 @@ func New(ctx context.Context, stripLengths []int, macDevice bool) (LEDs, error)
 		set:          make(chan State, setBuffer),
 		port:         port,
 		stripLengths: stripLengths,
+		clock:        clock.Real,
 		log:          log,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
 
 	l.wg.Add(1)
 	go l.run()
 
-	return l, nil
+	return l
 }
 
 func (l *leds) Close() error {
@@ -122,10 +149,10 @@ func (l *leds) Set(state State) {
 func (l *leds) run() {
 	defer l.wg.Done()
 
-	ticker := time.NewTicker(tickInterval)
+	ticker := l.clock.NewTicker(tickInterval)
 	defer ticker.Stop()
 
-	reconcile := time.NewTicker(reconcileInterval)
+	reconcile := l.clock.NewTicker(reconcileInterval)
 	defer reconcile.Stop()
 
 	currentState := l.all()
@@ -135,15 +162,15 @@ func (l *leds) run() {
 	l.write(currentState)
 
 	ticks := 0
-	last := time.Now()
+	last := l.clock.Now()
 	tickTime := time.Duration(0)
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			ticks++
-			tickTime += time.Since(last)
-			last = time.Now()
+			tickTime += l.clock.Since(last)
+			last = l.clock.Now()
 			if ticks%100 == 0 {
 				l.log.Tracef("Tick %d, average tick time: %v, lastTick: %v", ticks, tickTime/time.Duration(ticks), lastTick)
 			}
@@ -155,7 +182,7 @@ func (l *leds) run() {
 
 			lastTick = currentState.copy()
 
-		case <-reconcile.C:
+		case <-reconcile.C():
 			// send the full state to the LEDs
 			if err := l.write(currentState); err != nil {
 				l.log.Errorf("Failed to reconcile full state: %v", err)
@@ -208,6 +235,51 @@ func buildPacket(payload []byte) []byte {
 	return packet
 }
 
+// ParsePacket decodes the first packet built by buildPacket in b. It returns
+// the decoded pixels and the number of bytes consumed. If b does not yet hold a
+// complete packet, it returns io.ErrUnexpectedEOF and consumes nothing.
+func ParsePacket(b []byte) (State, int, error) {
+	start := 0
+	for start < len(b) && b[start] != 0xAA {
+		start++
+	}
+	if start > 0 {
+		return nil, start, fmt.Errorf("skipped %d bytes before start marker", start)
+	}
+	if len(b) < 3 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	length := int(b[1])<<8 | int(b[2])
+	if len(b) < 3+length+1 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := b[3 : 3+length]
+	checksum := byte(0)
+	for _, c := range payload {
+		checksum ^= c
+	}
+	if checksum != b[3+length] {
+		return nil, 3 + length + 1, fmt.Errorf("checksum mismatch: got %d, want %d", b[3+length], checksum)
+	}
+	if length%6 != 0 {
+		return nil, 3 + length + 1, fmt.Errorf("invalid payload length: %d", length)
+	}
+
+	state := State{}
+	for i := 0; i < length; i += 6 {
+		state.Set(int(payload[i]), int(payload[i+1]), Color{
+			R: payload[i+2],
+			G: payload[i+3],
+			B: payload[i+4],
+			W: payload[i+5],
+		})
+	}
+
+	return state, 3 + length + 1, nil
+}
+
 func (l *leds) all() State {
 	state := State{}
 	for strip, length := range l.stripLengths {
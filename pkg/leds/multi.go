@@ -0,0 +1,32 @@
+package leds
+
+import "errors"
+
+type multi []LEDs
+
+// Multi duplicates every call to each of the given LEDs.
+func Multi(ledStrips ...LEDs) LEDs {
+	return multi(ledStrips)
+}
+
+func (m multi) Close() error {
+	var errs []error
+	for _, l := range m {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) Clear() {
+	for _, l := range m {
+		l.Clear()
+	}
+}
+
+func (m multi) Set(state State) {
+	for _, l := range m {
+		l.Set(state)
+	}
+}
@@ -0,0 +1,62 @@
+package midi
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// General MIDI percussion notes, on DrumChannel.
+const (
+	NoteKick          = 36
+	NoteRimshot       = 37
+	NoteSnare         = 38
+	NoteClap          = 39
+	NoteClosedHiHat   = 42
+	NoteLowTom        = 45
+	NoteOpenHiHat     = 46
+	NoteCrash         = 49
+	NoteRide          = 51
+	NoteTambourine    = 54
+	NoteCowbell       = 56
+	NoteHighConga     = 62
+	NoteMaracas       = 70
+	NoteHighWoodBlock = 76
+)
+
+// drumNotes maps words in sound names to notes, more specific words first.
+var drumNotes = []struct {
+	word string
+	note uint8
+}{
+	{"openhat", NoteOpenHiHat},
+	{"open", NoteOpenHiHat},
+	{"hihat", NoteClosedHiHat},
+	{"hat", NoteClosedHiHat},
+	{"kick", NoteKick},
+	{"bass", NoteKick},
+	{"snare", NoteSnare},
+	{"clap", NoteClap},
+	{"rim", NoteRimshot},
+	{"tom", NoteLowTom},
+	{"crash", NoteCrash},
+	{"cymbal", NoteCrash},
+	{"ride", NoteRide},
+	{"tamb", NoteTambourine},
+	{"cowbell", NoteCowbell},
+	{"conga", NoteHighConga},
+	{"shaker", NoteMaracas},
+	{"block", NoteHighWoodBlock},
+	{"perc", NoteHighWoodBlock},
+}
+
+// DrumNote guesses the General MIDI note for a drum sound from its filename,
+// e.g. kick-808.wav is NoteKick. Unknown sounds are NoteRimshot.
+func DrumNote(filename string) uint8 {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	for _, d := range drumNotes {
+		if strings.Contains(name, d.word) {
+			return d.note
+		}
+	}
+	return NoteRimshot
+}
@@ -0,0 +1,256 @@
+// Package midi sends MIDI to a raw MIDI device, such as a USB MIDI interface at
+// /dev/snd/midiC1D0, or a virtual port from the snd-virmidi module to reach
+// the ALSA sequencer and any software listening on it.
+package midi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Out sends MIDI messages from its Ports at their scheduled time.
+	// Messages may be scheduled ahead in any order, they are written in time
+	// order.
+	Out struct {
+		w      io.WriteCloser
+		events chan event
+		quit   chan struct{}
+		wg     sync.WaitGroup
+		once   sync.Once
+		ports  atomic.Uint32
+
+		log *log.Entry
+	}
+
+	// Port sends one program's messages to an Out. Ports share the Out's
+	// notes, but only the newest sends transport, clock, start and stop, so
+	// followers only ever see one clock.
+	Port struct {
+		out *Out
+		id  uint32
+	}
+
+	event struct {
+		port uint32
+		at   time.Time
+		msg  []byte
+		// stop drops the port's pending messages, releasing its held notes,
+		// before sending msg
+		stop bool
+		// takeover makes the port the one sending transport, dropping the
+		// previous one's pending transport
+		takeover bool
+	}
+)
+
+const (
+	noteOff = 0x80
+	noteOn  = 0x90
+
+	clock = 0xF8
+	start = 0xFA
+	stop  = 0xFC
+
+	// DrumChannel is channel 10, General MIDI percussion
+	DrumChannel = 9
+	MaxNote     = 127
+
+	// PPQN is the number of clock messages per quarter note
+	PPQN = 24
+
+	channelBuffer = 1000
+)
+
+// Open sends MIDI to the raw MIDI device at path.
+func Open(path string) (*Out, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MIDI device: %w", err)
+	}
+
+	return New(f), nil
+}
+
+// New sends MIDI to w.
+func New(w io.WriteCloser) *Out {
+	o := &Out{
+		w:      w,
+		events: make(chan event, channelBuffer),
+		quit:   make(chan struct{}),
+		log:    log.WithField("bbox", "midi"),
+	}
+
+	o.wg.Add(1)
+	go o.run()
+
+	return o
+}
+
+// Port returns a new Port, which takes over sending transport from the
+// previous one, e.g. as a program starts while the previous one fades out.
+func (o *Out) Port() *Port {
+	p := &Port{out: o, id: o.ports.Add(1)}
+	o.send(event{port: p.id, takeover: true})
+	return p
+}
+
+// NoteOn starts note on channel at time at, with velocity from 1 to 127.
+func (p *Port) NoteOn(at time.Time, channel, note, velocity uint8) {
+	p.out.send(event{port: p.id, at: at, msg: []byte{noteOn | channel&0x0F, note & 0x7F, velocity & 0x7F}})
+}
+
+// NoteOff ends note on channel at time at.
+func (p *Port) NoteOff(at time.Time, channel, note uint8) {
+	p.out.send(event{port: p.id, at: at, msg: []byte{noteOff | channel&0x0F, note & 0x7F, 0}})
+}
+
+// Clock sends a timing clock at time at, PPQN per quarter note.
+func (p *Port) Clock(at time.Time) {
+	p.out.send(event{port: p.id, at: at, msg: []byte{clock}})
+}
+
+// Start tells followers to start from the top at time at. The first clock
+// after it is the first beat.
+func (p *Port) Start(at time.Time) {
+	p.out.send(event{port: p.id, at: at, msg: []byte{start}})
+}
+
+// Stop tells followers to stop now. The port's pending messages are dropped,
+// except note offs, which are sent right away. Other ports' messages are left
+// alone.
+func (p *Port) Stop() {
+	p.out.send(event{port: p.id, msg: []byte{stop}, stop: true})
+}
+
+// Close sends the messages already sent, releases held notes, and closes the
+// device.
+func (o *Out) Close() error {
+	o.once.Do(func() {
+		close(o.quit)
+	})
+	o.wg.Wait()
+
+	return o.w.Close()
+}
+
+func (o *Out) send(e event) {
+	select {
+	case <-o.quit:
+		return
+	default:
+	}
+
+	// never block the sequencer
+	select {
+	case o.events <- e:
+	default:
+		o.log.Warn("MIDI buffer full, dropping message")
+	}
+}
+
+func (o *Out) run() {
+	defer o.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	// pending is sorted by time, messages at the same time keep their order
+	var pending []event
+	// owner is the port sending transport
+	var owner uint32
+
+	// release sends the pending note offs of the ports matching port, and
+	// drops the rest of their messages
+	release := func(port func(uint32) bool) {
+		pending = slices.DeleteFunc(pending, func(p event) bool {
+			if !port(p.port) {
+				return false
+			}
+			if p.msg[0]&0xF0 == noteOff {
+				o.write(p.msg)
+			}
+			return true
+		})
+	}
+
+	handle := func(e event) {
+		switch {
+		case e.takeover:
+			pending = slices.DeleteFunc(pending, func(p event) bool {
+				return transport(p.msg)
+			})
+			owner = e.port
+			return
+
+		case e.stop:
+			release(func(port uint32) bool { return port == e.port })
+			if e.port == owner {
+				o.write(e.msg)
+			}
+			return
+
+		case transport(e.msg) && e.port != owner:
+			return
+		}
+
+		i := sort.Search(len(pending), func(i int) bool {
+			return pending[i].at.After(e.at)
+		})
+		pending = append(pending, event{})
+		copy(pending[i+1:], pending[i:])
+		pending[i] = e
+	}
+
+	for {
+		now := time.Now()
+		for len(pending) > 0 && !pending[0].at.After(now) {
+			o.write(pending[0].msg)
+			pending = pending[1:]
+		}
+
+		if len(pending) > 0 {
+			timer.Reset(time.Until(pending[0].at))
+		} else {
+			timer.Stop()
+		}
+
+		select {
+		case <-o.quit:
+			// messages sent before Close, e.g. a program's Stop, still go out
+			for {
+				select {
+				case e := <-o.events:
+					handle(e)
+				default:
+					release(func(uint32) bool { return true })
+					return
+				}
+			}
+
+		case e := <-o.events:
+			handle(e)
+
+		case <-timer.C:
+		}
+	}
+}
+
+// transport reports whether msg is a system real-time message, such as clock.
+func transport(msg []byte) bool {
+	return msg[0] >= clock
+}
+
+func (o *Out) write(msg []byte) {
+	if _, err := o.w.Write(msg); err != nil {
+		o.log.Errorf("write failed: %v", err)
+	}
+}
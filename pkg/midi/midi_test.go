@@ -0,0 +1,59 @@
+package midi
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+type buffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.Buffer.Write(p)
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestPorts(t *testing.T) {
+	w := &buffer{}
+	out := New(w)
+
+	at := time.Now().Add(30 * time.Millisecond)
+
+	outgoing := out.Port()
+	outgoing.NoteOn(at, DrumChannel, NoteKick, 100)
+	outgoing.NoteOff(at.Add(time.Second), DrumChannel, NoteKick)
+	outgoing.Clock(at)
+
+	// the incoming port takes over the clock, and the outgoing port's
+	// stop only drops its own messages
+	incoming := out.Port()
+	incoming.NoteOn(at, DrumChannel, NoteSnare, 100)
+	incoming.Clock(at)
+	outgoing.Clock(at)
+	outgoing.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	incoming.Stop()
+	out.Close()
+
+	want := []byte{
+		// the outgoing note off, released by its stop
+		noteOff | DrumChannel, NoteKick, 0,
+		noteOn | DrumChannel, NoteSnare, 100,
+		clock,
+		stop,
+	}
+	if got := w.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("sent % X, want % X", got, want)
+	}
+}
@@ -0,0 +1,146 @@
+package midiin
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/siggy/bbox/pkg/program"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Mapping turns notes and controller changes into presses.
+	Mapping struct {
+		// Channel only accepts messages on this channel, 1 to 16, 0 for any
+		Channel int
+		Notes   map[uint8]program.Coord
+		CCs     map[uint8]program.Coord
+	}
+
+	// mappingFile is a Mapping in YAML:
+	//
+	//	channel: 10
+	//	notes:
+	//	  - {note: 36, row: 1, col: 0}
+	//	ccs:
+	//	  - {cc: 20, row: 0, col: 15}
+	mappingFile struct {
+		Channel int `yaml:"channel"`
+		Notes   []struct {
+			Note uint8 `yaml:"note"`
+			Row  int   `yaml:"row"`
+			Col  int   `yaml:"col"`
+		} `yaml:"notes"`
+		CCs []struct {
+			CC  uint8 `yaml:"cc"`
+			Row int   `yaml:"row"`
+			Col int   `yaml:"col"`
+		} `yaml:"ccs"`
+	}
+)
+
+const (
+	MappingLaunchpad = "launchpad"
+	MappingLinear    = "linear"
+
+	// linearFirst is the first note of Linear, the first General MIDI drum
+	// and the bottom left pad of most drum pad controllers
+	linearFirst = 36
+
+	maxValue = 127
+)
+
+// LoadMapping returns a built-in mapping by name, MappingLaunchpad or
+// MappingLinear, or else reads a mapping file.
+func LoadMapping(name string) (Mapping, error) {
+	switch name {
+	case MappingLaunchpad:
+		return Launchpad(), nil
+	case MappingLinear:
+		return Linear(linearFirst), nil
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("failed to read mapping: %w", err)
+	}
+
+	f := mappingFile{}
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return Mapping{}, fmt.Errorf("failed to parse mapping %s: %w", name, err)
+	}
+
+	m := Mapping{
+		Channel: f.Channel,
+		Notes:   map[uint8]program.Coord{},
+		CCs:     map[uint8]program.Coord{},
+	}
+	for _, n := range f.Notes {
+		m.Notes[n.Note] = program.Coord{Row: n.Row, Col: n.Col}
+	}
+	for _, c := range f.CCs {
+		m.CCs[c.CC] = program.Coord{Row: c.Row, Col: c.Col}
+	}
+
+	if err := m.Validate(); err != nil {
+		return Mapping{}, fmt.Errorf("invalid mapping %s: %w", name, err)
+	}
+
+	return m, nil
+}
+
+// Launchpad maps an 8x8 grid in programmer mode, where the pad in row r from
+// the bottom and column c from the left sends note 10*r + c, both from 1. The
+// top half plays the left half of the buttons, and the bottom half the right.
+func Launchpad() Mapping {
+	m := Mapping{Notes: map[uint8]program.Coord{}}
+	for row := range program.Rows {
+		for col := range program.Cols {
+			padRow := 8 - row - col/8*program.Rows
+			m.Notes[uint8(10*padRow+col%8+1)] = program.Coord{Row: row, Col: col}
+		}
+	}
+	return m
+}
+
+// Linear maps a run of notes from first across the rows, for keyboards and
+// drum pads.
+func Linear(first uint8) Mapping {
+	m := Mapping{Notes: map[uint8]program.Coord{}}
+	for i := range program.Rows * program.Cols {
+		if note := int(first) + i; note <= maxValue {
+			m.Notes[uint8(note)] = program.Coord{Row: i / program.Cols, Col: i % program.Cols}
+		}
+	}
+	return m
+}
+
+// Validate checks the channel and that every press is a button.
+func (m Mapping) Validate() error {
+	if m.Channel < 0 || m.Channel > 16 {
+		return fmt.Errorf("channel must be between 1 and 16, or 0 for any: %d", m.Channel)
+	}
+
+	check := func(kind string, value uint8, c program.Coord) error {
+		if value > maxValue {
+			return fmt.Errorf("%s out of range: %d", kind, value)
+		}
+		if c.Row < 0 || c.Row >= program.Rows || c.Col < 0 || c.Col >= program.Cols {
+			return fmt.Errorf("%s %d: button out of range: %+v", kind, value, c)
+		}
+		return nil
+	}
+
+	for note, c := range m.Notes {
+		if err := check("note", note, c); err != nil {
+			return err
+		}
+	}
+	for cc, c := range m.CCs {
+		if err := check("cc", cc, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+// Package midiin reads MIDI from a raw MIDI device, such as a pad controller at
+// /dev/snd/midiC1D0, and turns it into presses, and into the tempo of a MIDI
+// clock master.
+package midiin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/siggy/bbox/pkg/input"
+	"github.com/siggy/bbox/pkg/midi"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/tempo"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Input reads MIDI until its device closes.
+	Input struct {
+		name    string
+		r       io.ReadCloser
+		mapping Mapping
+
+		presses chan program.Coord
+		tempos  chan tempo.Tempo
+
+		log *log.Entry
+	}
+
+	// clockState follows a MIDI clock master.
+	clockState struct {
+		stopped bool
+		// ticks counts clocks since the last start, a beat starts every
+		// midi.PPQN
+		ticks int
+		// times of the last midi.PPQN+1 clocks, to average the tempo over a
+		// beat
+		times []time.Time
+	}
+)
+
+const (
+	readBuffer    = 256
+	channelBuffer = 100
+)
+
+// Open reads MIDI from the raw MIDI device at path.
+func Open(path string, mapping Mapping) (*Input, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MIDI device: %w", err)
+	}
+
+	i := New(f, mapping)
+	i.name = path
+	return i, nil
+}
+
+// New reads MIDI from r.
+func New(r io.ReadCloser, mapping Mapping) *Input {
+	return &Input{
+		r:       r,
+		mapping: mapping,
+		presses: make(chan program.Coord, channelBuffer),
+		tempos:  make(chan tempo.Tempo, channelBuffer),
+
+		log: log.WithField("bbox", "midiin"),
+	}
+}
+
+func (i *Input) Device() input.Device {
+	return input.Device{Kind: input.KindMIDI, Name: i.name}
+}
+
+// Presses receives a press for every mapped note on, or controller change to
+// a non-zero value. It closes when Run returns.
+func (i *Input) Presses() <-chan program.Coord {
+	return i.presses
+}
+
+// Tempos receives the tempo of the clock master on every beat, while its clock
+// runs. Beat is the time of the beat's first clock, counted from the master's
+// start. Tempos are dropped if not read in time.
+func (i *Input) Tempos() <-chan tempo.Tempo {
+	return i.tempos
+}
+
+// Run reads MIDI until the device fails or is closed.
+func (i *Input) Run() {
+	defer close(i.presses)
+
+	p := parser{}
+	c := clockState{}
+	buf := make([]byte, readBuffer)
+
+	for {
+		n, err := i.r.Read(buf)
+		now := time.Now()
+
+		for _, b := range buf[:n] {
+			msg, ok := p.feed(b)
+			if !ok {
+				continue
+			}
+
+			if msg.status >= realTime {
+				if t, ok := c.handle(msg.status, now); ok {
+					i.log.Tracef("tempo: %+v", t)
+
+					select {
+					case i.tempos <- t:
+					default:
+					}
+				}
+				continue
+			}
+
+			if press, ok := i.mapping.press(msg); ok {
+				i.log.Debugf("press: %+v", press)
+				i.presses <- press
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				i.log.Errorf("read failed: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// Close closes the device, ending Run.
+func (i *Input) Close() error {
+	return i.r.Close()
+}
+
+// press returns the button a message presses, if any.
+func (m Mapping) press(msg message) (program.Coord, bool) {
+	if m.Channel != 0 && msg.channel() != m.Channel {
+		return program.Coord{}, false
+	}
+
+	var c program.Coord
+	var ok bool
+
+	switch msg.kind() {
+	case noteOn:
+		// a note on with zero velocity is a note off
+		if msg.data[1] == 0 {
+			return program.Coord{}, false
+		}
+		c, ok = m.Notes[msg.data[0]]
+
+	case controlChange:
+		// pads send a non-zero value when pressed, and zero when released
+		if msg.data[1] == 0 {
+			return program.Coord{}, false
+		}
+		c, ok = m.CCs[msg.data[0]]
+	}
+
+	return c, ok
+}
+
+// handle follows a real-time message, and returns the tempo on the first clock
+// of each beat.
+func (c *clockState) handle(status byte, now time.Time) (tempo.Tempo, bool) {
+	switch status {
+	case start:
+		*c = clockState{}
+
+	case cont:
+		// the pause would throw off the average
+		c.stopped = false
+		c.times = nil
+
+	case stop:
+		c.stopped = true
+
+	case clock:
+		if c.stopped {
+			break
+		}
+
+		c.times = append(c.times, now)
+		if len(c.times) > midi.PPQN+1 {
+			c.times = c.times[1:]
+		}
+
+		beat := c.ticks%midi.PPQN == 0
+		c.ticks++
+
+		if !beat || len(c.times) < 2 {
+			break
+		}
+
+		interval := c.times[len(c.times)-1].Sub(c.times[0]) / time.Duration(len(c.times)-1)
+		if interval <= 0 {
+			break
+		}
+
+		return tempo.Tempo{
+			BPM:        float64(time.Minute) / float64(interval*midi.PPQN),
+			Beat:       now,
+			Confidence: 1,
+		}, true
+	}
+
+	return tempo.Tempo{}, false
+}
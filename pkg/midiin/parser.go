@@ -0,0 +1,86 @@
+package midiin
+
+type (
+	// message is a channel or real-time message, data is unused for
+	// real-time messages
+	message struct {
+		status byte
+		data   [2]byte
+	}
+
+	// parser splits a raw MIDI byte stream into messages. It follows running
+	// status, lets real-time messages interrupt other messages, and skips
+	// system exclusive and system common messages.
+	parser struct {
+		// status is the running status, 0 for none
+		status byte
+		data   [2]byte
+		n      int
+	}
+)
+
+const (
+	noteOn        = 0x90
+	controlChange = 0xB0
+	programChange = 0xC0
+	pressure      = 0xD0
+
+	sysex     = 0xF0
+	clock     = 0xF8
+	start     = 0xFA
+	cont      = 0xFB
+	stop      = 0xFC
+	realTime  = 0xF8
+	statusBit = 0x80
+)
+
+func (m message) kind() byte {
+	return m.status & 0xF0
+}
+
+// channel is 1 to 16.
+func (m message) channel() int {
+	return int(m.status&0x0F) + 1
+}
+
+// feed adds a byte, and returns the message it completes, if any.
+func (p *parser) feed(b byte) (message, bool) {
+	switch {
+	case b >= realTime:
+		// real-time messages leave running status alone
+		return message{status: b}, true
+
+	case b >= sysex:
+		// system exclusive and common messages cancel running status, their
+		// data is dropped until the next status byte
+		p.status = 0
+		return message{}, false
+
+	case b&statusBit != 0:
+		p.status = b
+		p.n = 0
+		return message{}, false
+	}
+
+	if p.status == 0 {
+		return message{}, false
+	}
+
+	p.data[p.n] = b
+	p.n++
+	if p.n < dataLength(p.status) {
+		return message{}, false
+	}
+
+	p.n = 0
+	return message{status: p.status, data: p.data}, true
+}
+
+func dataLength(status byte) int {
+	switch status & 0xF0 {
+	case programChange, pressure:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,490 @@
+package mix
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/siggy/bbox/pkg/resample"
+)
+
+type (
+	// decoder streams a file decoded to mono samples at its own sample rate.
+	decoder interface {
+		sampleRate() int
+		// read fills p, returning io.EOF after the last sample
+		read(p []float32) (int, error)
+		// length is the number of samples, 0 if unknown
+		length() int64
+		// seek moves to sample, where the next read starts
+		seek(sample int64) error
+		close() error
+	}
+
+	wavDecoder struct {
+		file   *os.File
+		data   io.Reader
+		format wavFormat
+		decode func([]byte) float64
+		buf    []byte
+
+		// dataStart and dataSize locate the data chunk in the file, in bytes
+		dataStart int64
+		dataSize  int64
+	}
+
+	wavFormat struct {
+		audioFormat   uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+	}
+
+	flacDecoder struct {
+		file    *os.File
+		stream  *flac.Stream
+		scale   float64
+		pending []float32
+		// skip is the number of samples to drop after seeking to the start of
+		// a frame
+		skip int
+	}
+
+	mp3Decoder struct {
+		file    *os.File
+		decoder *mp3.Decoder
+		buf     []byte
+	}
+
+	oggDecoder struct {
+		file     *os.File
+		reader   *oggvorbis.Reader
+		channels int
+		buf      []float32
+	}
+)
+
+const (
+	formatPCM        = 1
+	formatIEEEFloat  = 3
+	formatExtensible = 0xFFFE
+
+	// decodeChunk is the number of samples decoded at a time
+	decodeChunk = 4096
+)
+
+var decoders = map[string]func(*os.File) (decoder, error){
+	".wav":  newWavDecoder,
+	".flac": newFlacDecoder,
+	".mp3":  newMP3Decoder,
+	".ogg":  newOggDecoder,
+}
+
+// Supported reports whether filename is in a format we decode.
+func Supported(filename string) bool {
+	_, ok := decoders[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+func openDecoder(filename string) (decoder, error) {
+	newDecoder, ok := decoders[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %s", filename)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open failed: %w", err)
+	}
+
+	d, err := newDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("decode %s failed: %w", filename, err)
+	}
+
+	return d, nil
+}
+
+// Probe checks filename can be decoded, without decoding it, e.g. before
+// streaming it.
+func Probe(filename string) error {
+	d, err := openDecoder(filename)
+	if err != nil {
+		return err
+	}
+	return d.close()
+}
+
+// Decode fully decodes a file of any supported format, downmixed to
+// mono and resampled to SampleRate.
+func Decode(filename string) ([]float32, error) {
+	d, err := openDecoder(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer d.close()
+
+	var samples []float32
+	buf := make([]float32, decodeChunk)
+	for {
+		n, err := d.read(buf)
+		samples = append(samples, buf[:n]...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode %s failed: %w", filename, err)
+		}
+	}
+
+	return resample.Resample(samples, d.sampleRate(), SampleRate), nil
+}
+
+// newWavDecoder decodes 8, 16, 24 and 32-bit PCM, and 32 and 64-bit float
+// wavs, including WAVE_FORMAT_EXTENSIBLE, with any number of channels.
+func newWavDecoder(file *os.File) (decoder, error) {
+	r := bufio.NewReader(file)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+
+	d := &wavDecoder{file: file}
+	offset := int64(len(header))
+	for d.data == nil {
+		chunk := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, errors.New("missing data chunk")
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		offset += int64(len(chunk))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmt chunk too short: %d", size)
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, fmt.Errorf("fmt chunk: %w", err)
+			}
+			d.format = wavFormat{
+				audioFormat:   binary.LittleEndian.Uint16(body[0:2]),
+				channels:      int(binary.LittleEndian.Uint16(body[2:4])),
+				sampleRate:    int(binary.LittleEndian.Uint32(body[4:8])),
+				bitsPerSample: int(binary.LittleEndian.Uint16(body[14:16])),
+			}
+			// the sub format GUID starts with the actual format code
+			if d.format.audioFormat == formatExtensible && size >= 26 {
+				d.format.audioFormat = binary.LittleEndian.Uint16(body[24:26])
+			}
+		case "data":
+			if d.format.channels == 0 {
+				return nil, errors.New("missing fmt chunk")
+			}
+			d.data = io.LimitReader(r, size)
+			d.dataStart = offset
+			d.dataSize = size
+			continue
+		default:
+			if _, err := r.Discard(int(size)); err != nil {
+				return nil, fmt.Errorf("%q chunk: %w", id, err)
+			}
+		}
+
+		// chunks are padded to an even size
+		if size%2 == 1 {
+			r.Discard(1)
+			size++
+		}
+		offset += size
+	}
+
+	if d.format.sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", d.format.sampleRate)
+	}
+	if d.blockAlign() <= 0 {
+		return nil, fmt.Errorf("invalid bits per sample: %d", d.format.bitsPerSample)
+	}
+
+	var err error
+	d.decode, err = sampleDecoder(d.format)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *wavDecoder) sampleRate() int {
+	return d.format.sampleRate
+}
+
+func (d *wavDecoder) blockAlign() int {
+	return d.format.bitsPerSample / 8 * d.format.channels
+}
+
+// read averages channels down to mono.
+func (d *wavDecoder) read(p []float32) (int, error) {
+	bytesPerSample := d.format.bitsPerSample / 8
+	blockAlign := d.blockAlign()
+
+	if cap(d.buf) < len(p)*blockAlign {
+		d.buf = make([]byte, len(p)*blockAlign)
+	}
+	n, err := io.ReadFull(d.data, d.buf[:len(p)*blockAlign])
+	if err == io.ErrUnexpectedEOF {
+		// a partial chunk, or a truncated file
+		err = io.EOF
+	}
+
+	frames := n / blockAlign
+	for i := range frames {
+		var sum float64
+		for ch := range d.format.channels {
+			offset := i*blockAlign + ch*bytesPerSample
+			sum += d.decode(d.buf[offset : offset+bytesPerSample])
+		}
+		p[i] = float32(math.Max(-1, math.Min(1, sum/float64(d.format.channels))))
+	}
+
+	return frames, err
+}
+
+func (d *wavDecoder) length() int64 {
+	return d.dataSize / int64(d.blockAlign())
+}
+
+func (d *wavDecoder) seek(sample int64) error {
+	offset := min(sample*int64(d.blockAlign()), d.dataSize)
+	if _, err := d.file.Seek(d.dataStart+offset, io.SeekStart); err != nil {
+		return err
+	}
+	d.data = io.LimitReader(bufio.NewReader(d.file), d.dataSize-offset)
+	return nil
+}
+
+func (d *wavDecoder) close() error {
+	return d.file.Close()
+}
+
+// sampleDecoder returns a func decoding one sample to [-1, 1].
+func sampleDecoder(format wavFormat) (func([]byte) float64, error) {
+	switch format.audioFormat {
+	case formatPCM:
+		switch format.bitsPerSample {
+		case 8:
+			// 8-bit wavs are unsigned
+			return func(b []byte) float64 {
+				return (float64(b[0]) - 128) / 128
+			}, nil
+		case 16:
+			return func(b []byte) float64 {
+				return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+			}, nil
+		case 24:
+			return func(b []byte) float64 {
+				v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+				return float64(v) / (1 << 23)
+			}, nil
+		case 32:
+			return func(b []byte) float64 {
+				return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+			}, nil
+		}
+	case formatIEEEFloat:
+		switch format.bitsPerSample {
+		case 32:
+			return func(b []byte) float64 {
+				return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}, nil
+		case 64:
+			return func(b []byte) float64 {
+				return math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported audio format code: %d", format.audioFormat)
+	}
+
+	return nil, fmt.Errorf("unsupported bits per sample for format %d: %d", format.audioFormat, format.bitsPerSample)
+}
+
+func newFlacDecoder(file *os.File) (decoder, error) {
+	stream, err := flac.NewSeek(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flacDecoder{
+		file:   file,
+		stream: stream,
+		scale:  math.Pow(2, float64(stream.Info.BitsPerSample)-1),
+	}, nil
+}
+
+func (d *flacDecoder) sampleRate() int {
+	return int(d.stream.Info.SampleRate)
+}
+
+func (d *flacDecoder) read(p []float32) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(d.pending) == 0 {
+			frame, err := d.stream.ParseNext()
+			if err != nil {
+				return n, err
+			}
+
+			channels := len(frame.Subframes)
+			samples := len(frame.Subframes[0].Samples)
+			skip := min(d.skip, samples)
+			d.skip -= skip
+			for i := skip; i < samples; i++ {
+				var sum float64
+				for _, subframe := range frame.Subframes {
+					sum += float64(subframe.Samples[i])
+				}
+				d.pending = append(d.pending, float32(sum/float64(channels)/d.scale))
+			}
+		}
+
+		copied := copy(p[n:], d.pending)
+		d.pending = d.pending[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+func (d *flacDecoder) length() int64 {
+	return int64(d.stream.Info.NSamples)
+}
+
+// seek moves to the start of the frame holding sample, and skips the rest of
+// the way on the next read.
+func (d *flacDecoder) seek(sample int64) error {
+	start, err := d.stream.Seek(uint64(sample))
+	if err != nil {
+		return err
+	}
+	d.pending = d.pending[:0]
+	d.skip = int(uint64(sample) - start)
+	return nil
+}
+
+func (d *flacDecoder) close() error {
+	return d.file.Close()
+}
+
+func newMP3Decoder(file *os.File) (decoder, error) {
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mp3Decoder{file: file, decoder: decoder}, nil
+}
+
+func (d *mp3Decoder) sampleRate() int {
+	return d.decoder.SampleRate()
+}
+
+// read downmixes the decoder's 16-bit stereo output.
+func (d *mp3Decoder) read(p []float32) (int, error) {
+	const blockAlign = 4
+
+	if cap(d.buf) < len(p)*blockAlign {
+		d.buf = make([]byte, len(p)*blockAlign)
+	}
+	n, err := io.ReadFull(d.decoder, d.buf[:len(p)*blockAlign])
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	frames := n / blockAlign
+	for i := range frames {
+		left := int16(binary.LittleEndian.Uint16(d.buf[i*blockAlign:]))
+		right := int16(binary.LittleEndian.Uint16(d.buf[i*blockAlign+2:]))
+		p[i] = float32((float64(left) + float64(right)) / 2 / (1 << 15))
+	}
+
+	return frames, err
+}
+
+// length converts the decoder's length in bytes of 16-bit stereo.
+func (d *mp3Decoder) length() int64 {
+	return max(0, d.decoder.Length()/4)
+}
+
+func (d *mp3Decoder) seek(sample int64) error {
+	_, err := d.decoder.Seek(sample*4, io.SeekStart)
+	return err
+}
+
+func (d *mp3Decoder) close() error {
+	return d.file.Close()
+}
+
+func newOggDecoder(file *os.File) (decoder, error) {
+	reader, err := oggvorbis.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oggDecoder{file: file, reader: reader, channels: reader.Channels()}, nil
+}
+
+func (d *oggDecoder) sampleRate() int {
+	return d.reader.SampleRate()
+}
+
+// read downmixes the reader's interleaved output.
+func (d *oggDecoder) read(p []float32) (int, error) {
+	if cap(d.buf) < len(p)*d.channels {
+		d.buf = make([]float32, len(p)*d.channels)
+	}
+
+	n := 0
+	for n < len(p) {
+		read, err := d.reader.Read(d.buf[:(len(p)-n)*d.channels])
+		frames := read / d.channels
+		for i := range frames {
+			var sum float32
+			for ch := range d.channels {
+				sum += d.buf[i*d.channels+ch]
+			}
+			p[n+i] = sum / float32(d.channels)
+		}
+		n += frames
+
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (d *oggDecoder) length() int64 {
+	return d.reader.Length()
+}
+
+func (d *oggDecoder) seek(sample int64) error {
+	return d.reader.SetPosition(sample)
+}
+
+func (d *oggDecoder) close() error {
+	return d.file.Close()
+}
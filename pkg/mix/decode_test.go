@@ -0,0 +1,226 @@
+package mix
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// the wav and flac fixtures hold 64 frames of levels, stereo ones with the
+// right channel at half the left's level, see levels
+const fixtureFrames = 64
+
+func TestDecoders(t *testing.T) {
+	testCases := []struct {
+		file     string
+		channels int
+		rate     int
+		// frames is how many frames decode, length how many the file says it
+		// has
+		frames int
+		length int64
+		// want is the first frames, downmixed to mono
+		want      []float64
+		tolerance float64
+	}{
+		{"pcm8.wav", 1, 22050, fixtureFrames, fixtureFrames, levels(1), 1.0 / 128},
+		{"pcm16.wav", 2, 44100, fixtureFrames, fixtureFrames, levels(0.75), 1e-6},
+		{"pcm24.wav", 1, 48000, fixtureFrames, fixtureFrames, levels(1), 1e-6},
+		{"pcm32.wav", 1, 32000, fixtureFrames, fixtureFrames, levels(1), 1e-6},
+		{"float32.wav", 2, 48000, fixtureFrames, fixtureFrames, levels(0.75), 1e-6},
+		{"float64.wav", 1, 44100, fixtureFrames, fixtureFrames, levels(1), 1e-6},
+		{"extensible.wav", 2, 96000, fixtureFrames, fixtureFrames, levels(0.75), 1e-6},
+		// the data chunk says 64 frames, but the file ends after 10
+		{"truncated.wav", 1, 44100, 10, fixtureFrames, levels(1)[:10], 1e-6},
+		{"pcm16.flac", 2, 44100, fixtureFrames, fixtureFrames, levels(0.75), 1e-6},
+		// go-mp3 always decodes to stereo
+		{"speech.mp3", 2, 22050, 40 * 576, 40 * 576, reference(t, "speech.mp3"), 1e-6},
+		{"vorbis.ogg", 1, 44100, 44100, 44100, reference(t, "vorbis.ogg"), 1e-6},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.file, func(t *testing.T) {
+			d, err := openDecoder(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatalf("openDecoder failed: %v", err)
+			}
+			defer d.close()
+
+			if got := channels(d); got != tc.channels {
+				t.Errorf("%d channels, want %d", got, tc.channels)
+			}
+			if got := d.sampleRate(); got != tc.rate {
+				t.Errorf("sample rate %d, want %d", got, tc.rate)
+			}
+			if got := d.length(); got != tc.length {
+				t.Errorf("length %d, want %d", got, tc.length)
+			}
+
+			samples := decodeAll(t, d)
+			if len(samples) != tc.frames {
+				t.Errorf("decoded %d frames, want %d", len(samples), tc.frames)
+			}
+			for i, want := range tc.want {
+				if i >= len(samples) {
+					break
+				}
+				if got := float64(samples[i]); math.Abs(got-want) > tc.tolerance {
+					t.Fatalf("frame %d is %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		file string
+		// data, if set, replaces the file's contents
+		data []byte
+		want string
+	}{
+		{"unsupported type", "sound.aiff", nil, "unsupported file type"},
+		{"missing", "missing.wav", nil, "no such file"},
+		{"text wav", "text.wav", []byte("not a sound\n"), "not a RIFF WAVE file"},
+		{"truncated fmt chunk", "pcm16.wav", fixture(t, "pcm16.wav")[:30], "fmt chunk: unexpected EOF"},
+		{"no data chunk", "nodata.wav", nil, "missing data chunk"},
+		{"unsupported format", "adpcm.wav", nil, "unsupported audio format code: 2"},
+		{"unsupported bits", "pcm12.wav", nil, "unsupported bits per sample for format 1: 12"},
+		{"text flac", "text.flac", []byte("not a sound\n"), "decode"},
+		{"text mp3", "text.mp3", []byte("not a sound\n"), "decode"},
+		{"text ogg", "text.ogg", []byte("not a sound\n"), "decode"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join("testdata", tc.file)
+			if tc.data != nil {
+				path = filepath.Join(t.TempDir(), tc.file)
+				if err := os.WriteFile(path, tc.data, 0o644); err != nil {
+					t.Fatalf("WriteFile failed: %v", err)
+				}
+			}
+
+			d, err := openDecoder(path)
+			if err == nil {
+				d.close()
+				t.Fatal("openDecoder succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// levels returns the fixtures' frames, downmixed to mono with the given gain.
+func levels(gain float64) []float64 {
+	samples := make([]float64, fixtureFrames)
+	for i := range samples {
+		samples[i] = float64(i%8-4) / 8 * gain
+	}
+	return samples
+}
+
+// reference decodes the first frames of a lossy fixture with its library
+// directly, and downmixes them.
+func reference(t *testing.T, file string) []float64 {
+	t.Helper()
+
+	const frames = 4096
+
+	f, err := os.Open(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	samples := make([]float64, frames)
+	switch filepath.Ext(file) {
+	case ".mp3":
+		d, err := mp3.NewDecoder(f)
+		if err != nil {
+			t.Fatalf("mp3.NewDecoder failed: %v", err)
+		}
+		b := make([]byte, frames*4)
+		if _, err := io.ReadFull(d, b); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		for i := range samples {
+			left := int16(binary.LittleEndian.Uint16(b[i*4:]))
+			right := int16(binary.LittleEndian.Uint16(b[i*4+2:]))
+			samples[i] = (float64(left) + float64(right)) / 2 / (1 << 15)
+		}
+	case ".ogg":
+		r, err := oggvorbis.NewReader(f)
+		if err != nil {
+			t.Fatalf("oggvorbis.NewReader failed: %v", err)
+		}
+		buf := make([]float32, frames*r.Channels())
+		for n := 0; n < len(buf); {
+			read, err := r.Read(buf[n:])
+			n += read
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+		}
+		for i := range samples {
+			var sum float64
+			for ch := range r.Channels() {
+				sum += float64(buf[i*r.Channels()+ch])
+			}
+			samples[i] = sum / float64(r.Channels())
+		}
+	}
+
+	return samples
+}
+
+func fixture(t *testing.T, file string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return b
+}
+
+func channels(d decoder) int {
+	switch d := d.(type) {
+	case *wavDecoder:
+		return d.format.channels
+	case *flacDecoder:
+		return int(d.stream.Info.NChannels)
+	case *mp3Decoder:
+		return 2
+	case *oggDecoder:
+		return d.channels
+	}
+	return 0
+}
+
+func decodeAll(t *testing.T, d decoder) []float32 {
+	t.Helper()
+
+	var samples []float32
+	buf := make([]float32, 1000)
+	for {
+		n, err := d.read(buf)
+		samples = append(samples, buf[:n]...)
+		if errors.Is(err, io.EOF) {
+			return samples
+		} else if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package mix
+
+import (
+	"math"
+	"slices"
+)
+
+type (
+	// Params control how a sound is mixed.
+	Params struct {
+		// Gain is between 0 and 1
+		Gain float64
+		// Pan is between -1 (left) and 1 (right), 0 is center
+		Pan float64
+		// Choke groups cut each other off, a sound starting in a non-zero
+		// group fades out every other sound in that group, e.g. a closed
+		// hi-hat cutting off an open one
+		Choke int
+	}
+
+	// mixer sums a bounded pool of voices into stereo frames, and limits the
+	// result. Finished voices are reclaimed as soon as they end.
+	mixer struct {
+		voices []*voice
+
+		// limiterGain is the current gain reduction of the master limiter
+		limiterGain float64
+	}
+
+	voice struct {
+		Event
+		pos int
+
+		left  float64
+		right float64
+
+		// fade is the number of frames left in a fade out, 0 if the voice is
+		// not fading out, and fadeLength the length of a fade from full gain
+		// at the same rate
+		fade       int
+		fadeLength int
+		tap        []float64
+		buf        []float32
+	}
+)
+
+const (
+	// SampleRate and Channels are the format of everything mixed
+	SampleRate = 44100
+	Channels   = 2
+
+	// maxVoices is the size of the pool, the oldest voice is stolen once
+	// maxPlaying are playing, leaving room for stolen and choked voices to
+	// fade out
+	maxVoices  = 32
+	maxPlaying = maxVoices - 8
+	// fadeFrames fades out choked and stolen voices without clicking
+	fadeFrames = SampleRate * 5 / 1000
+
+	limiterThreshold = 0.95
+	// limiterRelease recovers from gain reduction over about 100ms
+	limiterRelease = 1.0 / (SampleRate / 10)
+)
+
+func newMixer() *mixer {
+	return &mixer{limiterGain: 1}
+}
+
+// start adds a voice for e, choking its group and stealing the oldest voice
+// if too many are playing.
+func (m *mixer) start(e Event) {
+	if e.Choke != 0 {
+		for _, v := range m.voices {
+			if v.Choke == e.Choke {
+				v.fadeOut(fadeFrames)
+			}
+		}
+	}
+
+	playing := 0
+	for _, v := range m.voices {
+		if v.fade == 0 {
+			playing++
+		}
+	}
+	if playing >= maxPlaying {
+		for _, v := range m.voices {
+			if v.fade == 0 {
+				v.fadeOut(fadeFrames)
+				break
+			}
+		}
+	}
+
+	// a burst of voices may fill the pool with fading ones, drop the oldest
+	// so it never grows past maxVoices. Fewer than maxPlaying play, so one
+	// is fading.
+	if len(m.voices) >= maxVoices {
+		i := slices.IndexFunc(m.voices, func(v *voice) bool { return v.fade > 0 })
+		m.voices[i].close()
+		m.voices = slices.Delete(m.voices, i, i+1)
+	}
+
+	// balance pan, so centered sounds play at full gain in both channels
+	pan := math.Max(-1, math.Min(1, e.Pan))
+	m.voices = append(m.voices, &voice{
+		Event: e,
+		left:  e.Gain * math.Min(1, 1-pan),
+		right: e.Gain * math.Min(1, 1+pan),
+	})
+}
+
+// mix adds every voice into out, interleaved stereo frames.
+func (m *mixer) mix(out []float64) {
+	frames := len(out) / Channels
+
+	voices := m.voices[:0]
+	for _, v := range m.voices {
+		n := frames
+		if v.fade > 0 {
+			n = min(n, v.fade)
+		}
+		samples, done := v.next(n)
+		n = len(samples)
+
+		if v.Tap != nil {
+			v.tap = v.tap[:0]
+		}
+		for i := range n {
+			sample := float64(samples[i])
+			if v.fade > 0 {
+				sample *= float64(v.fade-i) / float64(v.fadeLength)
+			}
+
+			out[i*Channels] += sample * v.left
+			out[i*Channels+1] += sample * v.right
+			if v.Tap != nil {
+				v.tap = append(v.tap, sample*v.Gain)
+			}
+		}
+		if v.Tap != nil && n > 0 {
+			v.Tap(v.tap)
+		}
+
+		if v.fade > 0 {
+			v.fade -= n
+			if v.fade == 0 {
+				done = true
+			}
+		}
+		if done {
+			v.close()
+			continue
+		}
+		voices = append(voices, v)
+	}
+	clear(m.voices[len(voices):])
+	m.voices = voices
+}
+
+// limit applies the master limiter to out, reducing gain instantly on peaks
+// and recovering slowly, so loud passages don't clip.
+func (m *mixer) limit(out []float64) {
+	for i := 0; i < len(out); i += Channels {
+		// recover before checking the peak, so recovery never overshoots
+		m.limiterGain = math.Min(1, m.limiterGain+limiterRelease)
+
+		peak := math.Max(math.Abs(out[i]), math.Abs(out[i+1]))
+		if peak*m.limiterGain > limiterThreshold {
+			m.limiterGain = limiterThreshold / peak
+		}
+
+		out[i] *= m.limiterGain
+		out[i+1] *= m.limiterGain
+	}
+}
+
+// fadeOut fades out every voice over frames.
+func (m *mixer) fadeOut(frames int) {
+	for _, v := range m.voices {
+		v.fadeOut(frames)
+	}
+}
+
+// stop drops every voice.
+func (m *mixer) stop() {
+	for _, v := range m.voices {
+		v.close()
+	}
+	m.voices = nil
+}
+
+// next returns up to n of the voice's next samples, and whether it has ended.
+// Streams may return fewer samples if decoding falls behind.
+func (v *voice) next(n int) ([]float32, bool) {
+	if v.Stream != nil {
+		if cap(v.buf) < n {
+			v.buf = make([]float32, n)
+		}
+		read, done := v.Stream.read(v.buf[:n])
+		return v.buf[:read], done
+	}
+
+	n = min(n, len(v.Samples)-v.pos)
+	samples := v.Samples[v.pos : v.pos+n]
+	v.pos += n
+	return samples, v.pos >= len(v.Samples)
+}
+
+func (v *voice) close() {
+	if v.Stream != nil {
+		v.Stream.Close()
+	}
+}
+
+// fadeOut fades the voice out over frames, unless it is already fading out
+// sooner.
+func (v *voice) fadeOut(frames int) {
+	switch {
+	case v.fade == 0:
+		v.fade = frames
+		v.fadeLength = frames
+	case frames < v.fade:
+		// carry on from the current gain, at the faster rate
+		v.fadeLength = v.fadeLength * frames / v.fade
+		v.fade = frames
+	}
+}
@@ -0,0 +1,72 @@
+package mix
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"time"
+
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/youpy/go-wav"
+)
+
+// renderChunk is the number of frames rendered at a time
+const renderChunk = 4096
+
+// Render mixes sounds through a Sequencer, without an audio device, and writes
+// the result to w as a 44.1kHz 16-bit stereo wav. Each sound plays at its At
+// relative to start. The output is at least length long, and runs until the
+// last sound has finished. Sounds are loaded from dir.
+func Render(w io.Writer, dir string, sounds []program.Sound, start time.Time, length time.Duration) error {
+	buffers := map[string][]float32{}
+	seq := NewSequencer()
+
+	frames := int64(length.Seconds() * SampleRate)
+	for _, sound := range sounds {
+		buf, ok := buffers[sound.Name]
+		if !ok {
+			var err error
+			buf, err = Decode(filepath.Join(dir, sound.Name))
+			if err != nil {
+				return fmt.Errorf("Decode failed: %w", err)
+			}
+			buffers[sound.Name] = buf
+		}
+
+		frame := int64(math.Round(sound.At.Sub(start).Seconds() * SampleRate))
+		seq.Schedule(Event{
+			Frame:   frame,
+			Samples: buf,
+			Params:  Params{Gain: sound.Gain, Pan: sound.Pan, Choke: sound.Choke},
+		})
+		frames = max(frames, frame+int64(len(buf)))
+	}
+
+	writer := wav.NewWriter(w, uint32(frames), Channels, SampleRate, 16)
+
+	p := make([]byte, renderChunk*BytesPerFrame)
+	samples := make([]wav.Sample, 0, renderChunk)
+	for rendered := int64(0); rendered < frames; {
+		n := min(renderChunk, frames-rendered)
+		if _, err := seq.Read(p[:n*BytesPerFrame]); err != nil {
+			return fmt.Errorf("render failed: %w", err)
+		}
+
+		samples = samples[:0]
+		for i := range n {
+			samples = append(samples, wav.Sample{Values: [2]int{
+				int(int16(binary.LittleEndian.Uint16(p[i*BytesPerFrame:]))),
+				int(int16(binary.LittleEndian.Uint16(p[i*BytesPerFrame+2:]))),
+			}})
+		}
+		if err := writer.WriteSamples(samples); err != nil {
+			return fmt.Errorf("WriteSamples failed: %w", err)
+		}
+
+		rendered += n
+	}
+
+	return nil
+}
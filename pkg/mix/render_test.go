@@ -0,0 +1,128 @@
+package mix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/program"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// wavHeader is the size of the header go-wav writes
+const wavHeader = 44
+
+func TestRender(t *testing.T) {
+	// two beats at 480 bpm, a kick on each beat and a hat on every eighth. The
+	// kick is panned hard left and the hat hard right, so each channel
+	// holds one sound.
+	start := time.Unix(0, 0)
+	eighth := 125 * time.Millisecond / 2
+	var sounds []program.Sound
+	for i := range 4 {
+		at := start.Add(time.Duration(i) * eighth)
+		if i%2 == 0 {
+			sounds = append(sounds, program.Sound{Name: "kick.wav", Gain: 1, Pan: -1, At: at})
+		}
+		sounds = append(sounds, program.Sound{Name: "hat.wav", Gain: 0.5, Pan: 1, At: at})
+	}
+
+	var out bytes.Buffer
+	// shorter than the last hat, so the render runs on until it finishes
+	if err := Render(&out, "testdata", sounds, start, 150*time.Millisecond); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "pattern.golden.wav")
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	kick := decode(t, "kick.wav")
+	hat := decode(t, "hat.wav")
+
+	// eighths fall between frames, and round to the nearest
+	lastHat := int64(8269)
+	if frames := int64(out.Len()-wavHeader) / BytesPerFrame; frames != lastHat+int64(len(hat)) {
+		t.Fatalf("rendered %d frames, want %d", frames, lastHat+int64(len(hat)))
+	}
+
+	left, right := channelsOf(out.Bytes()[wavHeader:])
+	testCases := []struct {
+		name    string
+		channel []float64
+		sound   []float32
+		gain    float64
+		frames  []int64
+	}{
+		{"kick", left, kick, 1, []int64{0, 5513}},
+		{"hat", right, hat, 0.5, []int64{0, 2756, 5513, lastHat}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			from := int64(0)
+			for _, frame := range tc.frames {
+				first := firstSound(tc.channel[from:])
+				if first == -1 || from+first != frame {
+					t.Fatalf("sound starts at frame %d, want %d", from+first, frame)
+				}
+				for i, sample := range tc.sound[:10] {
+					if got, want := tc.channel[frame+int64(i)], float64(sample)*tc.gain; !near(got, want) {
+						t.Fatalf("frame %d is %v, want %v", frame+int64(i), got, want)
+					}
+				}
+				from = frame + int64(len(tc.sound))
+			}
+			if last := firstSound(tc.channel[from:]); last != -1 {
+				t.Errorf("sound at frame %d, want silence after the last one", from+last)
+			}
+		})
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes()[:wavHeader], want[:wavHeader]) {
+		t.Fatalf("header %x, want %x", out.Bytes()[:wavHeader], want[:wavHeader])
+	}
+	wantLeft, wantRight := channelsOf(want[wavHeader:])
+	if len(wantLeft) != len(left) {
+		t.Fatalf("rendered %d frames, golden has %d", len(left), len(wantLeft))
+	}
+	for i := range left {
+		if !near(left[i], wantLeft[i]) || !near(right[i], wantRight[i]) {
+			t.Fatalf("frame %d is (%v, %v), golden has (%v, %v)", i, left[i], right[i], wantLeft[i], wantRight[i])
+		}
+	}
+}
+
+func decode(t *testing.T, file string) []float32 {
+	t.Helper()
+
+	samples, err := Decode(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return samples
+}
+
+// channelsOf splits 16-bit stereo frames into channels scaled to [-1, 1].
+func channelsOf(p []byte) ([]float64, []float64) {
+	left := make([]float64, 0, len(p)/BytesPerFrame)
+	right := make([]float64, 0, len(p)/BytesPerFrame)
+	for i := 0; i+BytesPerFrame <= len(p); i += BytesPerFrame {
+		left = append(left, float64(int16(binary.LittleEndian.Uint16(p[i:])))/math.MaxInt16)
+		right = append(right, float64(int16(binary.LittleEndian.Uint16(p[i+2:])))/math.MaxInt16)
+	}
+	return left, right
+}
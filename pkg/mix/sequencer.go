@@ -0,0 +1,140 @@
+// Package mix decodes sounds and mixes them into 16-bit stereo PCM, without an
+// audio device, so it also renders offline and in tests. pkg/wavs plays the
+// mix through the sound card.
+package mix
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"sync"
+)
+
+type (
+	// Sequencer mixes samples into one continuous stream, each starting at an
+	// exact frame. It is an io.Reader of 16-bit little endian stereo PCM, read
+	// by a single oto.Player, or directly to render offline.
+	Sequencer struct {
+		mu sync.Mutex
+
+		// frame is the next frame Read renders
+		frame   int64
+		pending []Event // sorted by Frame
+		mixer   *mixer
+
+		mix []float64
+	}
+
+	// Event schedules Samples, or a Stream, to start playing at Frame. Events
+	// scheduled for a frame that was already rendered start at the next frame
+	// rendered.
+	Event struct {
+		Frame   int64
+		Samples []float32
+		// Stream is closed once it has played, or was stopped
+		Stream *Stream
+		Params
+
+		// Tap, if set, receives the samples of this event as they are mixed,
+		// e.g. for an equalizer.
+		Tap func(samples []float64)
+	}
+)
+
+// BytesPerFrame is the size of a frame of Sequencer output
+const BytesPerFrame = 2 * Channels
+
+func NewSequencer() *Sequencer {
+	return &Sequencer{mixer: newMixer()}
+}
+
+// Schedule adds an event. It is safe to call while the stream is being read.
+func (s *Sequencer) Schedule(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := sort.Search(len(s.pending), func(i int) bool {
+		return s.pending[i].Frame > e.Frame
+	})
+	s.pending = append(s.pending, Event{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = e
+}
+
+// Frame returns the next frame to be rendered. Events scheduled before it play
+// late.
+func (s *Sequencer) Frame() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frame
+}
+
+// Stop drops every playing and pending event.
+func (s *Sequencer) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.pending {
+		if e.Stream != nil {
+			e.Stream.Close()
+		}
+	}
+	s.pending = nil
+	s.mixer.stop()
+}
+
+// FadeOut drops every pending event, and fades out every playing one over
+// frames.
+func (s *Sequencer) FadeOut(frames int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.pending {
+		if e.Stream != nil {
+			e.Stream.Close()
+		}
+	}
+	s.pending = nil
+	s.mixer.fadeOut(frames)
+}
+
+// Read renders len(p)/4 frames. It never blocks, and renders silence when
+// nothing is playing.
+func (s *Sequencer) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := len(p) / BytesPerFrame
+	if cap(s.mix) < frames*Channels {
+		s.mix = make([]float64, frames*Channels)
+	}
+	mix := s.mix[:frames*Channels]
+	clear(mix)
+
+	end := s.frame + int64(frames)
+
+	// mix up to each event due in this buffer, then start it
+	pos := 0
+	for len(s.pending) > 0 && s.pending[0].Frame < end {
+		e := s.pending[0]
+		s.pending = s.pending[1:]
+
+		if offset := int(e.Frame - s.frame); offset > pos {
+			s.mixer.mix(mix[pos*Channels : offset*Channels])
+			pos = offset
+		}
+		s.mixer.start(e)
+	}
+	s.mixer.mix(mix[pos*Channels:])
+	s.mixer.limit(mix)
+
+	for i, sample := range mix {
+		sample = math.Max(-1, math.Min(1, sample))
+		binary.LittleEndian.PutUint16(p[i*2:], uint16(int16(sample*math.MaxInt16)))
+	}
+
+	s.frame = end
+
+	return frames * BytesPerFrame, nil
+}
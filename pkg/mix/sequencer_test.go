@@ -0,0 +1,183 @@
+package mix
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// readChunk is smaller than the tests' sounds, so events land mid-buffer and
+// span reads
+const readChunk = 1000
+
+func TestSequencerPlacement(t *testing.T) {
+	testCases := []struct {
+		name  string
+		frame int64
+	}{
+		{"first frame", 0},
+		{"second frame", 1},
+		{"mid buffer", 567},
+		{"last frame of a buffer", readChunk - 1},
+		{"first frame of a buffer", readChunk},
+		{"later buffer", 3*readChunk + 21},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seq := NewSequencer()
+			seq.Schedule(Event{Frame: tc.frame, Samples: constant(100, 0.5), Params: Params{Gain: 1}})
+
+			left, right := render(seq, 5*readChunk)
+
+			for _, ch := range [][]float64{left, right} {
+				first := firstSound(ch)
+				if first != tc.frame {
+					t.Fatalf("sound starts at frame %d, want %d", first, tc.frame)
+				}
+				if last := firstSound(ch[first+100:]); last != -1 {
+					t.Errorf("sound plays past its end, at frame %d", first+100+last)
+				}
+			}
+		})
+	}
+}
+
+func TestSequencerChoke(t *testing.T) {
+	testCases := []struct {
+		name   string
+		first  int
+		second int
+		// want is the level once any choked sound has faded out
+		want float64
+	}{
+		{"same group", 1, 1, 0.25},
+		{"different groups", 1, 2, 0.75},
+		{"no group", 0, 0, 0.75},
+		{"only the first in a group", 1, 0, 0.75},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seq := NewSequencer()
+			seq.Schedule(Event{Frame: 0, Samples: constant(5*readChunk, 0.5), Params: Params{Gain: 1, Choke: tc.first}})
+			seq.Schedule(Event{Frame: 1500, Samples: constant(5*readChunk, 0.25), Params: Params{Gain: 1, Choke: tc.second}})
+
+			left, _ := render(seq, 5*readChunk)
+
+			if got := left[1499]; !near(got, 0.5) {
+				t.Errorf("level before the second sound is %v, want 0.5", got)
+			}
+			// the choked sound fades, rather than clicking off
+			if got := left[1500+fadeFrames/2]; tc.want == 0.25 && (got <= 0.25 || got >= 0.75) {
+				t.Errorf("level mid fade is %v, want between 0.25 and 0.75", got)
+			}
+			if got := left[1500+fadeFrames]; !near(got, tc.want) {
+				t.Errorf("level after the fade is %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSequencerLimiter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		voices int
+		value  float32
+		want   float64
+	}{
+		{"quiet passes through", 1, 0.5, 0.5},
+		{"full scale is limited", 1, 1, limiterThreshold},
+		{"sum of voices is limited", 4, 0.5, limiterThreshold},
+		{"many voices are limited", maxVoices, 0.9, limiterThreshold},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			seq := NewSequencer()
+			for range tc.voices {
+				seq.Schedule(Event{Samples: constant(readChunk, tc.value), Params: Params{Gain: 1}})
+			}
+
+			left, right := render(seq, readChunk)
+
+			for _, ch := range [][]float64{left, right} {
+				peak := 0.0
+				for _, sample := range ch {
+					peak = math.Max(peak, math.Abs(sample))
+				}
+				if !near(peak, tc.want) {
+					t.Errorf("peak is %v, want %v", peak, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSequencerVoices(t *testing.T) {
+	seq := NewSequencer()
+	// a burst of voices, faster than stolen voices fade out
+	for i := range 4 * maxVoices {
+		seq.Schedule(Event{Frame: int64(i), Samples: constant(5*readChunk, 0.1), Params: Params{Gain: 1}})
+	}
+
+	p := make([]byte, BytesPerFrame)
+	for frame := range 4*maxVoices + fadeFrames {
+		seq.Read(p)
+
+		playing := 0
+		for _, v := range seq.mixer.voices {
+			if v.fade == 0 {
+				playing++
+			}
+		}
+		if len(seq.mixer.voices) > maxVoices || playing > maxPlaying {
+			t.Fatalf("%d voices, %d playing, at frame %d, want at most %d and %d", len(seq.mixer.voices), playing, frame, maxVoices, maxPlaying)
+		}
+	}
+
+	if playing := len(seq.mixer.voices); playing != maxPlaying {
+		t.Errorf("%d voices once stolen voices faded out, want %d", playing, maxPlaying)
+	}
+}
+
+// render reads frames from seq, readChunk at a time, and returns each channel
+// scaled to [-1, 1].
+func render(seq *Sequencer, frames int) ([]float64, []float64) {
+	left := make([]float64, 0, frames)
+	right := make([]float64, 0, frames)
+
+	p := make([]byte, readChunk*BytesPerFrame)
+	for len(left) < frames {
+		seq.Read(p)
+		for i := 0; i < len(p); i += BytesPerFrame {
+			left = append(left, float64(int16(binary.LittleEndian.Uint16(p[i:])))/math.MaxInt16)
+			right = append(right, float64(int16(binary.LittleEndian.Uint16(p[i+2:])))/math.MaxInt16)
+		}
+	}
+
+	return left[:frames], right[:frames]
+}
+
+func constant(n int, value float32) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = value
+	}
+	return samples
+}
+
+// firstSound returns the first frame that isn't silent, or -1.
+func firstSound(samples []float64) int64 {
+	for i, sample := range samples {
+		if sample != 0 {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+// near allows for 16-bit quantization.
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= 2.0/math.MaxInt16
+}
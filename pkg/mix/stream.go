@@ -0,0 +1,244 @@
+package mix
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/siggy/bbox/pkg/resample"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Stream plays a long file from disk. A goroutine decodes and resamples
+	// ahead of playback, so the mixer never waits on the disk. A Stream may be
+	// paused and seeked while it plays.
+	Stream struct {
+		chunks   chan chunk
+		seeks    chan seek
+		quit     chan struct{}
+		once     sync.Once
+		paused   atomic.Bool
+		duration time.Duration
+
+		// mu guards the playback position, which the mixer advances and
+		// Seek moves
+		mu sync.Mutex
+		// gen counts seeks, chunks decoded before the latest seek are dropped
+		gen int
+		// frame is the next frame played
+		frame int64
+		// cur is the rest of the chunk being played
+		cur []float32
+		// ended is set once the last chunk has been read
+		ended bool
+
+		log *log.Entry
+	}
+
+	chunk struct {
+		gen     int
+		samples []float32
+		// last is set on the final chunk of the file
+		last bool
+	}
+
+	seek struct {
+		gen   int
+		frame int64
+	}
+)
+
+const (
+	// StreamSize is the file size from which sounds stream from disk instead
+	// of being decoded into memory, about 45 seconds of 16-bit mono wav
+	StreamSize = 4 << 20
+
+	// streamAhead is the number of chunks decoded ahead, about 1.5 seconds
+	streamAhead = 16
+)
+
+// OpenStream starts decoding filename.
+func OpenStream(filename string) (*Stream, error) {
+	d, err := openDecoder(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{
+		chunks:   make(chan chunk, streamAhead),
+		seeks:    make(chan seek),
+		quit:     make(chan struct{}),
+		duration: time.Duration(d.length()) * time.Second / time.Duration(d.sampleRate()),
+		log:      log.WithFields(log.Fields{"bbox": "mix", "stream": filename}),
+	}
+	go s.decode(d)
+
+	return s, nil
+}
+
+// Close stops playback and decoding. It is safe to call more than once.
+func (s *Stream) Close() {
+	s.once.Do(func() {
+		close(s.quit)
+	})
+}
+
+// Done is closed once the stream has played to the end, or been closed.
+func (s *Stream) Done() <-chan struct{} {
+	return s.quit
+}
+
+// Duration is the length of the file, 0 if unknown.
+func (s *Stream) Duration() time.Duration {
+	return s.duration
+}
+
+// Position is how far playback has got.
+func (s *Stream) Position() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return time.Duration(s.frame) * time.Second / SampleRate
+}
+
+// Pause holds playback at the current position.
+func (s *Stream) Pause() {
+	s.paused.Store(true)
+}
+
+// Resume continues playback after Pause.
+func (s *Stream) Resume() {
+	s.paused.Store(false)
+}
+
+// Seek moves playback to position. Playback resumes there once the decoder
+// catches up, which takes a few milliseconds.
+func (s *Stream) Seek(position time.Duration) {
+	frame := max(0, int64(position.Seconds()*SampleRate))
+
+	s.mu.Lock()
+	s.gen++
+	gen := s.gen
+	s.frame = frame
+	s.cur = nil
+	s.ended = false
+	s.mu.Unlock()
+
+	select {
+	case s.seeks <- seek{gen: gen, frame: frame}:
+	case <-s.quit:
+	}
+}
+
+func (s *Stream) decode(d decoder) {
+	defer d.close()
+
+	resampler := resample.New(d.sampleRate(), SampleRate).Stream()
+	buf := make([]float32, decodeChunk)
+	gen := 0
+	ended := false
+
+	for {
+		// decode the next chunk, and offer it until it is taken or a seek
+		// replaces it
+		var out chan chunk
+		var next chunk
+		if !ended {
+			n, err := d.read(buf)
+			if err != nil && err != io.EOF {
+				s.log.Errorf("decode failed: %v", err)
+			}
+
+			ended = err != nil
+			next = chunk{gen: gen, samples: resampler.Process(buf[:n], ended), last: ended}
+			out = s.chunks
+		}
+
+		select {
+		case out <- next:
+		case sk := <-s.seeks:
+			gen = sk.gen
+			ended = false
+			resampler = resample.New(d.sampleRate(), SampleRate).Stream()
+
+			sample := sk.frame * int64(d.sampleRate()) / SampleRate
+			if length := d.length(); length > 0 && sample >= length {
+				ended = true
+				if !s.send(chunk{gen: gen, last: true}) {
+					return
+				}
+			} else if err := d.seek(sample); err != nil {
+				s.log.Errorf("seek failed: %v", err)
+				ended = true
+				if !s.send(chunk{gen: gen, last: true}) {
+					return
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// send offers c to the mixer, returning false if the stream closed first.
+func (s *Stream) send(c chunk) bool {
+	select {
+	case s.chunks <- c:
+		return true
+	case <-s.quit:
+		return false
+	}
+}
+
+// read fills p with whatever has been decoded, without blocking. It returns
+// done once the whole file has been played, or the stream closed.
+func (s *Stream) read(p []float32) (n int, done bool) {
+	select {
+	case <-s.quit:
+		return 0, true
+	default:
+	}
+
+	if s.paused.Load() {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n < len(p) {
+		if len(s.cur) == 0 {
+			if s.ended {
+				return n, true
+			}
+
+			select {
+			case <-s.quit:
+				return n, true
+			default:
+			}
+
+			select {
+			case c := <-s.chunks:
+				if c.gen != s.gen {
+					continue
+				}
+				s.cur = c.samples
+				s.ended = c.last
+			default:
+				s.log.Debug("underrun")
+				return n, false
+			}
+			continue
+		}
+
+		copied := copy(p[n:], s.cur)
+		s.cur = s.cur[copied:]
+		s.frame += int64(copied)
+		n += copied
+	}
+
+	return n, false
+}
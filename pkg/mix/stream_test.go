@@ -0,0 +1,76 @@
+package mix
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youpy/go-wav"
+)
+
+func TestStreamClose(t *testing.T) {
+	stream, err := OpenStream(writeWav(t, 5*SampleRate, 0.5))
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	seq := NewSequencer()
+	seq.Schedule(Event{Stream: stream, Params: Params{Gain: 1}})
+
+	// read until the decoder has caught up and the stream is audible
+	p := make([]byte, 1024*BytesPerFrame)
+	for deadline := time.Now().Add(5 * time.Second); silent(p); {
+		if time.Now().After(deadline) {
+			t.Fatal("stream never played")
+		}
+		time.Sleep(time.Millisecond)
+		seq.Read(p)
+	}
+
+	stream.Close()
+	seq.Read(p)
+
+	if !silent(p) {
+		t.Error("stream played after Close")
+	}
+	if len(seq.mixer.voices) != 0 {
+		t.Errorf("mixer has %d voices after Close, want 0", len(seq.mixer.voices))
+	}
+}
+
+// writeWav writes a mono 16-bit wav of n samples at value to a temporary file.
+func writeWav(t *testing.T, n int, value float64) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	defer f.Close()
+
+	samples := make([]wav.Sample, n)
+	for i := range samples {
+		samples[i].Values[0] = int(value * (1<<15 - 1))
+	}
+
+	w := wav.NewWriter(f, uint32(n), 1, SampleRate, 16)
+	if err := w.WriteSamples(samples); err != nil {
+		t.Fatalf("WriteSamples failed: %v", err)
+	}
+
+	return path
+}
+
+// silent reports whether every sample of 16-bit PCM p is 0.
+func silent(p []byte) bool {
+	for i := 0; i < len(p); i += 2 {
+		if binary.LittleEndian.Uint16(p[i:]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// message is an OSC message, its arguments are int32, float32 or string.
+type message struct {
+	address string
+	args    []any
+}
+
+const bundleTag = "#bundle"
+
+// parsePacket returns the messages in an OSC packet, a message or a bundle of
+// them. Bundle time tags are ignored, messages apply on arrival.
+func parsePacket(b []byte) ([]message, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty packet")
+	}
+
+	if b[0] == '/' {
+		msg, err := parseMessage(b)
+		if err != nil {
+			return nil, err
+		}
+		return []message{msg}, nil
+	}
+
+	tag, rest, err := readString(b)
+	if err != nil {
+		return nil, err
+	}
+	if tag != bundleTag {
+		return nil, fmt.Errorf("not a message or bundle: %q", tag)
+	}
+	if len(rest) < 8 {
+		return nil, errors.New("bundle missing time tag")
+	}
+	rest = rest[8:]
+
+	var msgs []message
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return nil, errors.New("truncated bundle element")
+		}
+		size := int(binary.BigEndian.Uint32(rest))
+		rest = rest[4:]
+		if size > len(rest) || size%4 != 0 {
+			return nil, fmt.Errorf("invalid bundle element size: %d", size)
+		}
+
+		elems, err := parsePacket(rest[:size])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, elems...)
+		rest = rest[size:]
+	}
+
+	return msgs, nil
+}
+
+func parseMessage(b []byte) (message, error) {
+	address, rest, err := readString(b)
+	if err != nil {
+		return message{}, err
+	}
+
+	msg := message{address: address}
+
+	// a message without a type tag string has no arguments
+	if len(rest) == 0 {
+		return msg, nil
+	}
+
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return message{}, err
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return message{}, fmt.Errorf("invalid type tags: %q", tags)
+	}
+
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return message{}, fmt.Errorf("truncated argument for %s", address)
+			}
+			bits := binary.BigEndian.Uint32(rest)
+			rest = rest[4:]
+
+			if tag == 'i' {
+				msg.args = append(msg.args, int32(bits))
+			} else {
+				msg.args = append(msg.args, math.Float32frombits(bits))
+			}
+
+		case 's':
+			var s string
+			s, rest, err = readString(rest)
+			if err != nil {
+				return message{}, err
+			}
+			msg.args = append(msg.args, s)
+
+		case 'T':
+			msg.args = append(msg.args, int32(1))
+		case 'F':
+			msg.args = append(msg.args, int32(0))
+
+		default:
+			return message{}, fmt.Errorf("unsupported type tag %q for %s", tag, address)
+		}
+	}
+
+	return msg, nil
+}
+
+// readString reads a null terminated string, padded to a multiple of 4 bytes.
+func readString(b []byte) (string, []byte, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", nil, errors.New("unterminated string")
+	}
+
+	padded := (end + 4) &^ 3
+	if padded > len(b) {
+		return "", nil, errors.New("truncated string padding")
+	}
+
+	return string(b[:end]), b[padded:], nil
+}
+
+// number returns an int32 or float32 argument as an int.
+func number(arg any) (int, bool) {
+	switch v := arg.(type) {
+	case int32:
+		return int(v), true
+	case float32:
+		return int(v), true
+	}
+	return 0, false
+}
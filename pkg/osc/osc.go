@@ -0,0 +1,170 @@
+// Package osc listens for Open Sound Control messages over UDP, so tablets and
+// show-control software on the LAN can press buttons and switch programs:
+//
+//	/bbox/press row col [value]
+//	/bbox/program next|<name> [value]
+//
+// Numbers may be ints or floats. An optional trailing value of 0, as sent by
+// buttons when released, is ignored.
+package osc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/siggy/bbox/pkg/input"
+	"github.com/siggy/bbox/pkg/program"
+	log "github.com/sirupsen/logrus"
+)
+
+// Server receives OSC messages. It is an input.Source.
+type Server struct {
+	conn net.PacketConn
+	wg   sync.WaitGroup
+
+	presses  chan program.Coord
+	programs chan string
+
+	log *log.Entry
+}
+
+const (
+	AddressPress   = "/bbox/press"
+	AddressProgram = "/bbox/program"
+
+	// ProgramNext moves to the next program in the roster
+	ProgramNext = "next"
+
+	// maxPacket is the largest UDP payload
+	maxPacket = 65535
+)
+
+// New starts listening on addr, e.g. :9000.
+func New(addr string) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s := &Server{
+		conn:     conn,
+		presses:  make(chan program.Coord, program.ChannelBuffer),
+		programs: make(chan string, program.ChannelBuffer),
+
+		log: log.WithField("bbox", "osc"),
+	}
+
+	s.log.Infof("Listening on udp %s", conn.LocalAddr())
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Server) Device() input.Device {
+	return input.Device{Kind: input.KindOSC, Name: s.conn.LocalAddr().String()}
+}
+
+// Presses receives /bbox/press messages. It closes when the Server does.
+func (s *Server) Presses() <-chan program.Coord {
+	return s.presses
+}
+
+// Programs receives /bbox/program commands, ProgramNext or a program name. It
+// closes when the Server does.
+func (s *Server) Programs() <-chan string {
+	return s.programs
+}
+
+func (s *Server) Close() error {
+	err := s.conn.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+	defer close(s.presses)
+	defer close(s.programs)
+
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Errorf("ReadFrom failed: %v", err)
+			}
+			return
+		}
+
+		msgs, err := parsePacket(buf[:n])
+		if err != nil {
+			s.log.Warnf("Ignoring packet from %s: %v", from, err)
+			continue
+		}
+
+		for _, msg := range msgs {
+			s.log.Debugf("message from %s: %s %v", from, msg.address, msg.args)
+			s.handle(msg)
+		}
+	}
+}
+
+func (s *Server) handle(msg message) {
+	switch msg.address {
+	case AddressPress:
+		if len(msg.args) < 2 || len(msg.args) > 3 || released(msg.args[2:]) {
+			break
+		}
+
+		row, rowOK := number(msg.args[0])
+		col, colOK := number(msg.args[1])
+		if !rowOK || !colOK || row < 0 || row >= program.Rows || col < 0 || col >= program.Cols {
+			s.log.Warnf("Ignoring press: %v", msg.args)
+			break
+		}
+
+		// enqueue input non-blockingly
+		select {
+		case s.presses <- program.Coord{Row: row, Col: col}:
+		default:
+		}
+
+	case AddressProgram:
+		if len(msg.args) < 1 || len(msg.args) > 2 || released(msg.args[1:]) {
+			break
+		}
+
+		name, ok := msg.args[0].(string)
+		if !ok {
+			s.log.Warnf("Ignoring program: %v", msg.args)
+			break
+		}
+
+		select {
+		case s.programs <- name:
+		default:
+		}
+
+	default:
+		s.log.Debugf("Ignoring address %s", msg.address)
+	}
+}
+
+// released reports whether an optional trailing value is 0.
+func released(value []any) bool {
+	if len(value) == 0 {
+		return false
+	}
+
+	switch v := value[0].(type) {
+	case int32:
+		return v == 0
+	case float32:
+		return v == 0
+	}
+	return false
+}
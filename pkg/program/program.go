@@ -2,6 +2,7 @@ package program
 
 import (
 	"context"
+	"time"
 
 	"github.com/siggy/bbox/pkg/equalizer"
 	"github.com/siggy/bbox/pkg/leds"
@@ -22,7 +23,7 @@ type (
 		EQ(equalizer.DisplayData)
 
 		// output
-		Play() <-chan string
+		Play() <-chan Sound
 		PlayWithEQ() <-chan string
 		Render() <-chan leds.State
 		Yield() <-chan struct{}
@@ -31,7 +32,57 @@ type (
 		Close()
 	}
 
+	// Sound is a wav to play, at a Gain between 0 and 1
+	Sound struct {
+		Name string
+		Gain float64
+		// Pan is between -1 (left) and 1 (right)
+		Pan float64
+		// Choke is a group of sounds that cut each other off, 0 for none
+		Choke int
+		// At is when to play, zero plays immediately
+		At time.Time
+	}
+
 	ProgramFactory func(ctx context.Context) Program
+
+	// Track controls long-form playback, such as a song
+	Track interface {
+		Pause()
+		Resume()
+		Seek(position time.Duration)
+		Position() time.Duration
+		// Duration is 0 if unknown
+		Duration() time.Duration
+		// Done is closed once playback finishes or the track is closed
+		Done() <-chan struct{}
+		Close()
+	}
+
+	// Tracks plays long-form tracks from the wavs directory
+	Tracks interface {
+		// PlayTrack starts playing filename, feeding the equalizer
+		PlayTrack(filename string) (Track, error)
+		// ListTracks returns every playable file in dir, a directory in the
+		// wavs directory
+		ListTracks(dir string) ([]string, error)
+	}
+
+	// Grid is the on/off state of every button
+	Grid [Rows][Cols]bool
+
+	// GridProgram is optionally implemented by programs with a beat grid to
+	// display, such as beats
+	GridProgram interface {
+		Grid() Grid
+	}
+
+	// TempoProgram is optionally implemented by programs that can follow the
+	// tempo of music in the room, such as beats. SyncTempo is called with
+	// every new estimate, beats fall every 60/bpm seconds around beat.
+	TempoProgram interface {
+		SyncTempo(bpm float64, beat time.Time)
+	}
 )
 
 const (
@@ -6,8 +6,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/siggy/bbox/pkg/clock"
 	"github.com/siggy/bbox/pkg/equalizer"
 	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/midi"
 	"github.com/siggy/bbox/pkg/program"
 	"github.com/siggy/bbox/pkg/rows"
 	log "github.com/sirupsen/logrus"
@@ -20,21 +22,41 @@ type (
 		wg     sync.WaitGroup
 
 		in     chan program.Coord
-		play   chan string
+		tempo  chan roomTempo
+		play   chan program.Sound
 		render chan leds.State
 		yield  chan struct{}
 
-		beatColor    leds.Color
-		pulseColor   leds.Color
-		sounds       [program.Rows]string
-		starterBeats []program.Coord
-		starterBPM   int
-		beatLimit    int
+		preset Preset
+
+		gridLock sync.Mutex
+		grid     program.Grid
+
+		store Store
+		midi  *midi.Port
+		clock clock.Clock
 
 		log *log.Entry
 	}
 
-	timers [program.Rows][program.Cols]*time.Timer
+	// Option configures optional beats behavior.
+	Option func(*beats)
+
+	// roomTempo is the tempo of music in the room, see SyncTempo
+	roomTempo struct {
+		bpm  float64
+		beat time.Time
+	}
+
+	// scheduled is a step sent to play at a time
+	scheduled struct {
+		step   int
+		at     time.Time
+		length time.Duration
+	}
+
+	timers    [program.Rows][MaxSteps]clock.Timer
+	deadlines [program.Rows][MaxSteps]time.Time
 )
 
 const (
@@ -44,30 +66,43 @@ const (
 	pulseDelay   = -1.3
 	pulseLength  = 50.0
 
-	// test
-	// decay             = 2 * time.Second
-	// keepAliveInterval = 5 * time.Second
-	// tempoDecay        = 5 * time.Second
+	// lookahead must cover a tick plus the audio output's buffer
+	lookahead = 60 * time.Millisecond
 
-	// prod
-	decay             = 3 * time.Minute
-	keepAliveInterval = 14 * time.Minute
-	tempoDecay        = 3 * time.Minute
+	// saveDelay batches the changes saved to the store, a burst of presses
+	// writes one snapshot
+	saveDelay = 2 * time.Second
 )
 
-var (
-	tempoUp   = program.Coord{Row: 0, Col: program.Cols - 1}
-	tempoDown = program.Coord{Row: 1, Col: program.Cols - 1}
-)
+// WithStore restores the grid from store on start, and saves it shortly after
+// it changes, and on Close.
+func WithStore(store Store) Option {
+	return func(b *beats) {
+		b.store = store
+	}
+}
+
+// WithMIDI sends each step to out as General MIDI drum notes, and the tempo
+// as MIDI clock. Each program gets its own port on out, and the newest sends
+// the clock.
+func WithMIDI(out *midi.Out) Option {
+	return func(b *beats) {
+		b.midi = out.Port()
+	}
+}
+
+// WithClock runs the program on c instead of the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(b *beats) {
+		b.clock = c
+	}
+}
+
+func New(preset Preset, opts ...Option) program.ProgramFactory {
+	preset = preset.withDefaults()
 
-func New(
-	name string,
-	beatColor, pulseColor leds.Color,
-	sounds [program.Rows]string, starterBeats []program.Coord,
-	bpm int, beatLimit int,
-) program.ProgramFactory {
 	return func(ctx context.Context) program.Program {
-		log := log.WithFields(log.Fields{"program": "beats", "song": name})
+		log := log.WithFields(log.Fields{"program": "beats", "song": preset.Name})
 		log.Debug("New")
 
 		ctx, cancel := context.WithCancel(ctx)
@@ -76,19 +111,19 @@ func New(
 			cancel: cancel,
 
 			in:     make(chan program.Coord, program.ChannelBuffer),
-			play:   make(chan string, program.ChannelBuffer),
+			tempo:  make(chan roomTempo, program.ChannelBuffer),
+			play:   make(chan program.Sound, program.ChannelBuffer),
 			render: make(chan leds.State, program.ChannelBuffer),
 			yield:  make(chan struct{}, program.ChannelBuffer),
 
-			beatColor:    beatColor,
-			pulseColor:   pulseColor,
-			sounds:       sounds,
-			starterBeats: starterBeats,
-			starterBPM:   bpm,
-			beatLimit:    beatLimit,
+			preset: preset,
+			clock:  clock.Real,
 
 			log: log,
 		}
+		for _, opt := range opts {
+			opt(b)
+		}
 
 		b.wg.Add(1)
 		go b.run()
@@ -124,11 +159,30 @@ func (b *beats) Press(press program.Coord) {
 	}
 }
 
+// SyncTempo follows the room's tempo, if the preset asks to.
+func (b *beats) SyncTempo(bpm float64, beat time.Time) {
+	if !b.preset.SyncTempo {
+		return
+	}
+
+	select {
+	case <-b.ctx.Done():
+		return
+	default:
+	}
+
+	// enqueue input non-blockingly
+	select {
+	case b.tempo <- roomTempo{bpm: bpm, beat: beat}:
+	default:
+	}
+}
+
 func (b *beats) EQ(equalizer.DisplayData) {
 	b.log.Warn("EQ called, but not used in beats program")
 }
 
-func (b *beats) Play() <-chan string {
+func (b *beats) Play() <-chan program.Sound {
 	return b.play
 }
 func (b *beats) PlayWithEQ() <-chan string {
@@ -138,28 +192,38 @@ func (b *beats) Render() <-chan leds.State {
 	return b.render
 }
 
+func (b *beats) Grid() program.Grid {
+	b.gridLock.Lock()
+	defer b.gridLock.Unlock()
+
+	return b.grid
+}
+
 func (b *beats) run() {
 	defer b.wg.Done()
 
+	p := b.preset
+	c := b.clock
+	columns := p.columns()
+
+	// beatIndex is the next step to be heard
 	beatIndex := 0
 	beatState := state{}
 
-	bpm := b.starterBPM
+	bpm := p.BPM
 	bpmCh := make(chan int, program.ChannelBuffer)
 
-	beatsPerTick := getBeatsPerTick(bpm)
-	var beatAcc float64
-
 	decayCh := make(chan program.Coord, program.ChannelBuffer)
 
 	decayTimers := timers{}
+	decayAt := deadlines{}
 	defer func() {
 		for _, arr := range decayTimers {
 			for _, t := range arr {
 				if t != nil {
 					if !t.Stop() {
 						select {
-						case <-t.C:
+						case <-t.C():
 						default:
 						}
 					}
@@ -168,42 +232,229 @@ func (b *beats) run() {
 		}
 	}()
 
-	keepAlive := time.NewTimer(keepAliveInterval)
+	keepAlive := c.NewTimer(p.KeepAlive)
 	if !keepAlive.Stop() {
-		<-keepAlive.C
+		<-keepAlive.C()
 	}
 	defer func() {
 		if !keepAlive.Stop() {
 			select {
-			case <-keepAlive.C:
+			case <-keepAlive.C():
 			default:
 			}
 		}
 	}()
 
-	tempoReset := time.NewTimer(tempoDecay)
+	tempoReset := c.NewTimer(p.TempoDecay)
 	if !tempoReset.Stop() {
-		<-tempoReset.C
+		<-tempoReset.C()
 	}
+	var tempoResetAt time.Time
 	defer func() {
 		if !tempoReset.Stop() {
 			select {
-			case <-tempoReset.C:
+			case <-tempoReset.C():
 			default:
 			}
 		}
 	}()
 
-	ticker := time.NewTicker(tickInterval)
+	ticker := c.NewTicker(tickInterval)
 	defer ticker.Stop()
 
-	tickTime := time.Now()
+	// dirty is set while changes wait for saveTimer to save them
+	dirty := false
+	saveTimer := c.NewTimer(saveDelay)
+	if !saveTimer.Stop() {
+		<-saveTimer.C()
+	}
+	save := func() {
+		if dirty {
+			dirty = false
+			b.save(beatState, bpm, decayAt, tempoResetAt)
+		}
+	}
+	changed := func() {
+		if !dirty {
+			dirty = true
+			saveTimer.Reset(saveDelay)
+		}
+	}
+	defer func() {
+		if !saveTimer.Stop() {
+			select {
+			case <-saveTimer.C():
+			default:
+			}
+		}
+		save()
+	}()
+
+	tempo := tempoControl{}
+	// a press of tempoKey is held back for doublePress, so the second press
+	// of a double press can enter tempo mode without either touching the
+	// grid. heldStep is the step it edits once heldTimer fires, Row is -1 if
+	// tempoKey sits outside a short pattern.
+	held := false
+	var heldStep program.Coord
+	heldTimer := c.NewTimer(doublePress)
+	if !heldTimer.Stop() {
+		<-heldTimer.C()
+	}
+	defer func() {
+		if !heldTimer.Stop() {
+			select {
+			case <-heldTimer.C():
+			default:
+			}
+		}
+	}()
+
+	// set changes the level of a step, Col is the step index in the pattern.
+	// It returns false if the beat limit was reached and the program yielded.
+	set := func(step program.Coord, level Level) bool {
+		// disable decay timer
+		if decayTimers[step.Row][step.Col] != nil {
+			decayTimers[step.Row][step.Col].Stop()
+		}
+
+		// update the beat state
+		enabling := beatState[step.Row][step.Col] == Off && level != Off
+		beatState[step.Row][step.Col] = level
+
+		b.log.Debugf("Updated beat state:\n%s", beatState)
 
-	lastPress := program.Coord{Row: -1, Col: -1}
+		page := beatIndex / program.Cols
+		b.setGrid(beatState, page)
 
-	// starter beat
-	for _, coord := range b.starterBeats {
-		b.in <- coord
+		color := leds.Brightness(p.BeatColor, level.brightness())
+
+		if level == Off {
+			// disabling a beat
+			decayAt[step.Row][step.Col] = time.Time{}
+
+			if beatState.allOff() {
+				if !keepAlive.Stop() {
+					select {
+					case <-keepAlive.C():
+					default:
+					}
+				}
+				keepAlive.Reset(p.KeepAlive)
+			}
+		} else {
+			if enabling && beatState.activeButtons() >= p.BeatLimit {
+				b.log.Debugf("Beat limit reached (%d active buttons), yielding...", beatState.activeButtons())
+				// start fresh next time
+				dirty = false
+				b.forget()
+				b.yield <- struct{}{}
+				return false
+			}
+
+			// set a decay timer, changing a beat's level restarts it
+			decayAt[step.Row][step.Col] = c.Now().Add(p.Decay)
+			decayTimers[step.Row][step.Col] = c.AfterFunc(p.Decay, func() {
+				select {
+				case decayCh <- step:
+				default:
+				}
+			})
+
+			// we've enabled a beat, kill keepAlive
+			if !keepAlive.Stop() {
+				select {
+				case <-keepAlive.C():
+				default:
+				}
+			}
+		}
+
+		changed()
+
+		// only steps on the current page have a button
+		if step.Col/program.Cols == page {
+			ledsState := leds.State{}
+			phys := rows.Rows[step.Row].Buttons[step.Col%program.Cols]
+			ledsState.Set(phys.Strip, phys.Pixel, color)
+			b.render <- ledsState
+		}
+
+		return true
+	}
+
+	// release applies a held press of tempoKey, if any. It returns false if
+	// the beat limit was reached and the program yielded.
+	release := func() bool {
+		if !held {
+			return true
+		}
+		held = false
+		if !heldTimer.Stop() {
+			select {
+			case <-heldTimer.C():
+			default:
+			}
+		}
+
+		if heldStep.Row < 0 {
+			return true
+		}
+		return set(heldStep, beatState[heldStep.Row][heldStep.Col].next())
+	}
+
+	// restore the last snapshot, beats that decayed in the meantime stay off
+	if snapshot, ok := b.load(); ok {
+		now := c.Now()
+		for _, d := range snapshot.Decays {
+			if d.Row < 0 || d.Row >= program.Rows || d.Col < 0 || d.Col >= p.Steps ||
+				snapshot.Grid[d.Row][d.Col] == Off || !d.At.After(now) {
+				continue
+			}
+
+			step := d.Coord
+			beatState[step.Row][step.Col] = snapshot.Grid[step.Row][step.Col]
+			decayAt[step.Row][step.Col] = d.At
+			decayTimers[step.Row][step.Col] = c.AfterFunc(d.At.Sub(now), func() {
+				select {
+				case decayCh <- step:
+				default:
+				}
+			})
+		}
+
+		if snapshot.TempoReset.After(now) && snapshot.BPM >= minBPM && snapshot.BPM <= maxBPM {
+			bpm = snapshot.BPM
+			tempoResetAt = snapshot.TempoReset
+			tempoReset.Reset(snapshot.TempoReset.Sub(now))
+		}
+	}
+
+	if beatState.allOff() {
+		// starter beat
+		for _, step := range p.StarterBeats {
+			if !set(step.Coord, step.Level) {
+				return
+			}
+		}
+	} else {
+		b.log.Debugf("Restored beat state:\n%s", beatState)
+		b.setGrid(beatState, 0)
+	}
+
+	// steps are scheduled lookahead ahead of time, so they play at their exact
+	// time regardless of when the ticker fires. The timeline starts with the
+	// last step, as if it had just played, so the first step waits for it.
+	now := c.Now()
+	timeline := []scheduled{{step: p.Steps - 1, at: now, length: stepDuration(bpm, p, p.Steps-1)}}
+	nextStep := 0
+	nextStepAt := now.Add(timeline[0].length)
+	// clockAt is when the next MIDI clock is due
+	clockAt := nextStepAt
+
+	if b.midi != nil {
+		b.midi.Start(nextStepAt)
+		defer b.midi.Stop()
 	}
 
 	for {
@@ -212,9 +463,66 @@ func (b *beats) run() {
 			return
 
 		// beat loop
-		case <-ticker.C:
+		case <-ticker.C():
+			now := c.Now()
+
+			if tempo.expired(now) {
+				b.log.Debug("Tempo mode timed out")
+				tempo.exit()
+			}
+
+			if now.Sub(nextStepAt) > lookahead {
+				// we fell behind, don't play the backlog all at once
+				b.log.Debugf("Fell behind by %v", now.Sub(nextStepAt))
+				nextStepAt = now
+			}
+
+			// schedule steps due within the lookahead
+			for nextStepAt.Before(now.Add(lookahead)) {
+				for rowIdx, beats := range beatState {
+					if level := beats[nextStep]; level != Off {
+						b.play <- p.sound(rowIdx, level, nextStepAt)
+					}
+				}
+
+				length := stepDuration(bpm, p, nextStep)
+				if nextStep%p.StepsPerBeat == 0 {
+					// the clock lines up with each beat
+					clockAt = nextStepAt
+				}
+				clockAt = b.sendMIDI(beatState, nextStep, bpm, nextStepAt, length, clockAt)
+				timeline = append(timeline, scheduled{step: nextStep, at: nextStepAt, length: length})
+				nextStep = (nextStep + 1) % p.Steps
+				nextStepAt = nextStepAt.Add(length)
+			}
+
+			// find the last step heard
+			for len(timeline) > 1 && !timeline[1].at.After(now) {
+				timeline = timeline[1:]
+			}
+			heard := timeline[0]
+
+			lastPage := beatIndex / program.Cols
+			beatIndex = (heard.step + 1) % p.Steps
+			// beatAcc is how far we are towards beatIndex, it follows the
+			// swung step lengths
+			beatAcc := min(float64(now.Sub(heard.at))/float64(heard.length), 1)
+
+			page := beatIndex / program.Cols
+			if page != lastPage {
+				b.setGrid(beatState, page)
+			}
+
+			if tempo.active {
+				b.render <- tempo.render(bpm, heard.step%p.StepsPerBeat == 0, p)
+				continue
+			}
+
 			ledsState := leds.State{}
 
+			// the last page of a long pattern may be partially used
+			pageColumns := min(columns, p.Steps-page*program.Cols)
+
 			// for each row, clear its full physical range:
 			for _, row := range rows.FlatRows {
 				for _, pixel := range row.Pixels {
@@ -222,58 +530,37 @@ func (b *beats) run() {
 				}
 			}
 
-			// use beatAcc to determine peak location
+			// use beatAcc to determine peak location, beatAcc follows the
+			// swung step lengths
 			for _, row := range rows.FlatRows {
-				peak := float64(beatIndex) + beatAcc + pulseDelay
+				peak := float64(beatIndex%program.Cols) + beatAcc + pulseDelay
 				if peak < 0 {
-					peak += float64(program.Cols)
+					peak += float64(pageColumns)
 				}
-				pulse := getPulse(row, peak, b.pulseColor)
+				pulse := getPulse(row, peak, p.PulseColor, pageColumns)
 
 				for coord, color := range pulse {
 					ledsState.Set(coord.Strip, coord.Pixel, color)
 				}
 			}
 
-			// set active beats to red
+			// set active beats to red, dimmed by level
 			for rowIdx, beats := range beatState {
-				for i, beat := range beats {
-					if beat {
+				for i := range pageColumns {
+					if level := beats[page*program.Cols+i]; level != Off {
 						redPos := rows.FlatRows[rowIdx].Buttons[i]
 						redIndex := rows.FlatRows[rowIdx].Pixels[redPos]
-						ledsState.Set(redIndex.Strip, redIndex.Pixel, b.beatColor)
+						ledsState.Set(redIndex.Strip, redIndex.Pixel, leds.Brightness(p.BeatColor, level.brightness()))
 					}
 				}
 			}
 			b.render <- ledsState
 
-			beatAcc += beatsPerTick
-			for beatAcc >= 0.999999 {
-				beatAcc = 0
-
-				// play active beats if index matches
-				for rowIdx, beats := range beatState {
-					for i, beat := range beats {
-						if beat {
-							if i == beatIndex {
-								b.play <- b.sounds[rowIdx]
-							}
-						}
-					}
-				}
-
-				// advance to next beat column
-				beatIndex = (beatIndex + 1) % program.Cols
-			}
-
-			t := time.Now()
 			b.log.Tracef("BPM:___________%+v_", bpm)
-			b.log.Tracef("int:___________%+v_", tickInterval)
-			b.log.Tracef("time:__________%+v_", t.Sub(tickTime))
 			b.log.Tracef("beatIndex:_____%+v_", beatIndex)
-			b.log.Tracef("beatsPerTick:__%+v_", beatsPerTick)
 			b.log.Tracef("beatAcc:_______%+v_", beatAcc)
-			tickTime = t
+			b.log.Tracef("nextStep:______%+v_", nextStep)
+			b.log.Tracef("nextStepAt:____%+v_", nextStepAt.Sub(now))
 
 		case press := <-b.in:
 			b.log.Debugf("Processing press: %+v", press)
@@ -283,131 +570,271 @@ func (b *beats) run() {
 				continue
 			}
 
-			// disable decay timer
-			if decayTimers[press.Row][press.Col] != nil {
-				decayTimers[press.Row][press.Col].Stop()
-			}
+			now := c.Now()
 
-			// toggle the beat state
-			disabling := beatState[press.Row][press.Col]
-			beatState[press.Row][press.Col] = !disabling
-
-			b.log.Debugf("Updated beat state:\n%s", beatState)
-
-			color := b.beatColor
-
-			if disabling {
-				// disabling a beat
-				color = leds.Black
+			if tempo.active {
+				if newBPM := tempo.press(press, now); newBPM != 0 {
+					bpmCh <- newBPM
+				}
+				continue
+			}
 
-				if beatState.allOff() {
-					if !keepAlive.Stop() {
+			// presses edit the page currently playing
+			step := program.Coord{Row: press.Row, Col: beatIndex/program.Cols*program.Cols + press.Col}
+			valid := press.Col < columns && step.Col < p.Steps
+
+			if press == tempoKey {
+				if held {
+					// the first press is dropped, tempo keys may sit outside
+					// a short pattern
+					b.log.Debug("Entering tempo mode")
+					held = false
+					if !heldTimer.Stop() {
 						select {
-						case <-keepAlive.C:
+						case <-heldTimer.C():
 						default:
 						}
 					}
-					keepAlive.Reset(keepAliveInterval)
+					tempo.enter(now)
+					continue
 				}
-			} else {
-				// enabling a beat
 
-				if beatState.activeButtons() >= b.beatLimit {
-					b.log.Debugf("Beat limit reached (%d active buttons), yielding...", beatState.activeButtons())
-					b.yield <- struct{}{}
-					return
+				held = true
+				heldStep = program.Coord{Row: -1}
+				if valid {
+					heldStep = step
 				}
+				heldTimer.Reset(doublePress)
+				continue
+			}
 
-				// set a decay timer
-				decayTimers[press.Row][press.Col] = time.AfterFunc(decay, func() {
-					select {
-					case decayCh <- press:
-					default:
-					}
-				})
+			// presses edit the grid in order
+			if !release() {
+				return
+			}
 
-				// we've enabled a beat, kill keepAlive
-				if !keepAlive.Stop() {
-					select {
-					case <-keepAlive.C:
-					default:
-					}
-				}
+			if !valid {
+				continue
 			}
 
-			ledsState := leds.State{}
-			phys := rows.Rows[press.Row].Buttons[press.Col]
-			ledsState.Set(phys.Strip, phys.Pixel, color)
-			b.render <- ledsState
+			if !set(step, beatState[step.Row][step.Col].next()) {
+				return
+			}
 
-			// check for tempo changes
-			increasingTempo := lastPress == tempoUp && press == tempoUp && bpm < maxBPM
-			decreasingTempo := lastPress == tempoDown && press == tempoDown && bpm > minBPM
-			if increasingTempo || decreasingTempo {
-				if increasingTempo {
-					bpmCh <- bpm + 4
-				}
-				if decreasingTempo {
-					bpmCh <- bpm - 4
-				}
+		case room := <-b.tempo:
+			synced := foldTempo(room.bpm, p.BPM)
+			b.log.Tracef("Room tempo %.1f, synced to %.1f", room.bpm, synced)
+
+			// small wobbles in the estimate don't change the tempo
+			if math.Abs(synced-float64(bpm)) >= 1 {
+				bpmCh <- int(math.Round(synced))
 			}
-			lastPress = press
+
+			// move halfway towards lining the next beat up with the room's,
+			// steps already scheduled keep their time
+			period := time.Duration(float64(time.Minute) / synced)
+			at := nextStepAt
+			for step := nextStep; step%p.StepsPerBeat != 0; step = (step + 1) % p.Steps {
+				at = at.Add(stepDuration(bpm, p, step))
+			}
+			offset := at.Sub(room.beat) % period
+			if offset < 0 {
+				offset += period
+			}
+			if offset > period/2 {
+				offset -= period
+			}
+			nextStepAt = nextStepAt.Add(-offset / 2)
 
 		case newBPM := <-bpmCh:
+			if newBPM == bpm {
+				continue
+			}
 			b.log.Debugf("BPM changed from %d to %d", bpm, newBPM)
 
+			// steps already scheduled keep their time
 			bpm = newBPM
-			beatsPerTick = getBeatsPerTick(bpm)
 
 			// reset the tempo after a decay period
 			if !tempoReset.Stop() {
 				select {
-				case <-tempoReset.C:
+				case <-tempoReset.C():
 				default:
 				}
 			}
-			if bpm != b.starterBPM {
-				tempoReset.Reset(tempoDecay)
+			tempoResetAt = time.Time{}
+			if bpm != p.BPM {
+				tempoReset.Reset(p.TempoDecay)
+				tempoResetAt = c.Now().Add(p.TempoDecay)
 			}
 
-		case coord := <-decayCh:
-			b.log.Debugf("Decay timer expired for press: %+v", coord)
-			select {
-			case b.in <- coord:
-			default:
+			changed()
+
+		case <-saveTimer.C():
+			save()
+
+		case <-heldTimer.C():
+			if !release() {
+				return
 			}
 
-		case <-keepAlive.C:
-			select {
-			case b.in <- program.Coord{Row: 1, Col: 0}:
-			default:
+		case step := <-decayCh:
+			b.log.Debugf("Decay timer expired for step: %+v", step)
+			if !set(step, Off) {
+				return
+			}
+
+		case <-keepAlive.C():
+			if !set(program.Coord{Row: 1, Col: 0}, Normal) {
+				return
 			}
 
-		case <-tempoReset.C:
-			bpmCh <- b.starterBPM
+		case <-tempoReset.C():
+			bpmCh <- p.BPM
+		}
+	}
+}
+
+// sendMIDI sends a step's notes, and its clocks from clockAt, see midiClocks.
+// It returns when the next step's first clock is due.
+func (b *beats) sendMIDI(s state, step, bpm int, at time.Time, length time.Duration, clockAt time.Time) time.Time {
+	if b.midi == nil {
+		return clockAt
+	}
+
+	p := b.preset
+	for row, beats := range s {
+		if level := beats[step]; level != Off {
+			b.midi.NoteOn(at, midi.DrumChannel, p.Notes[row], level.velocity())
+			b.midi.NoteOff(at.Add(length/2), midi.DrumChannel, p.Notes[row])
 		}
 	}
+
+	clocks, next := midiClocks(p, step, bpm, clockAt)
+	for _, at := range clocks {
+		b.midi.Clock(at)
+	}
+	return next
+}
+
+// midiClocks returns the MIDI clocks due in a step, the first at at, and when
+// the next step's first clock is due. The clock follows bpm alone, swing only
+// moves the notes. A beat's clocks are shared out between its steps, so odd
+// step counts still add up to midi.PPQN per beat.
+func midiClocks(p Preset, step, bpm int, at time.Time) ([]time.Time, time.Time) {
+	k := step % p.StepsPerBeat
+	n := (k+1)*midi.PPQN/p.StepsPerBeat - k*midi.PPQN/p.StepsPerBeat
+	interval := time.Minute / time.Duration(bpm*midi.PPQN)
+
+	clocks := make([]time.Time, n)
+	for i := range clocks {
+		clocks[i] = at
+		at = at.Add(interval)
+	}
+	return clocks, at
 }
 
 func (b *beats) Yield() <-chan struct{} {
 	return b.yield
 }
 
-func getBeatsPerTick(bpm int) float64 {
-	// total ticks per beat
-	ticksPerBeat := math.Round(
-		(60.0 / tickInterval.Seconds()) / (4.0 * float64(bpm)),
-	)
-	return 1.0 / ticksPerBeat
+// setGrid publishes the given page of the grid for Grid.
+func (b *beats) setGrid(s state, page int) {
+	b.gridLock.Lock()
+	defer b.gridLock.Unlock()
+
+	b.grid = s.page(page)
+}
+
+func (b *beats) load() (Snapshot, bool) {
+	if b.store == nil {
+		return Snapshot{}, false
+	}
+
+	snapshot, ok, err := b.store.Load(b.preset.Name)
+	if err != nil {
+		b.log.Warnf("Failed to load snapshot: %v", err)
+		return Snapshot{}, false
+	}
+	if !ok || snapshot.empty() {
+		return Snapshot{}, false
+	}
+
+	return snapshot, true
+}
+
+func (b *beats) save(s state, bpm int, decayAt deadlines, tempoResetAt time.Time) {
+	if b.store == nil {
+		return
+	}
+
+	snapshot := Snapshot{
+		Grid:       s,
+		BPM:        bpm,
+		TempoReset: tempoResetAt,
+	}
+	for row := range decayAt {
+		for col, at := range decayAt[row] {
+			if s[row][col] != Off && !at.IsZero() {
+				snapshot.Decays = append(snapshot.Decays, Decay{Coord: program.Coord{Row: row, Col: col}, At: at})
+			}
+		}
+	}
+
+	if err := b.store.Save(b.preset.Name, snapshot); err != nil {
+		b.log.Warnf("Failed to save snapshot: %v", err)
+	}
+}
+
+func (b *beats) forget() {
+	if b.store == nil {
+		return
+	}
+
+	if err := b.store.Delete(b.preset.Name); err != nil {
+		b.log.Warnf("Failed to delete snapshot: %v", err)
+	}
+}
+
+// stepDuration returns how long the given step lasts, until the next step.
+func stepDuration(bpm int, p Preset, step int) time.Duration {
+	// swing pairs steps within each beat, and lengthens the first of each
+	// pair by as much as it shortens the second, so beats keep their length.
+	// A step without a pair, at the end of an odd beat or pattern, is
+	// straight.
+	share := p.Swing / 50
+	switch k := step % p.StepsPerBeat; {
+	case k%2 == 1:
+		share = 2 - share
+	case k+1 == p.StepsPerBeat || step+1 == p.Steps:
+		share = 1
+	}
+
+	return time.Duration(float64(time.Minute) / float64(bpm*p.StepsPerBeat) * share)
+}
+
+// foldTempo doubles or halves bpm to within half an octave of target, so the
+// pattern keeps its feel when the room is heard at half or double time.
+func foldTempo(bpm float64, target int) float64 {
+	if bpm <= 0 {
+		return float64(target)
+	}
+	for bpm < float64(target)/math.Sqrt2 {
+		bpm *= 2
+	}
+	for bpm > float64(target)*math.Sqrt2 {
+		bpm /= 2
+	}
+	return max(minBPM, min(maxBPM, bpm))
 }
 
 // getPulse returns map of coord -> brightness
-// 0 <= peak < 16
+// 0 <= peak < columns
 // TODO: cache results?
-func getPulse(r rows.FlatRow, peak float64, color leds.Color) map[rows.Coord]leds.Color {
+func getPulse(r rows.FlatRow, peak float64, color leds.Color, columns int) map[rows.Coord]leds.Color {
 	pulse := make(map[rows.Coord]leds.Color)
 
-	floatPeakPixel := peakToFloatPixel(r, peak)
+	floatPeakPixel := peakToFloatPixel(r, peak, columns)
 
 	startIndex := int(math.Ceil(floatPeakPixel - pulseLength))
 	endIndex := int(math.Ceil(floatPeakPixel))
@@ -438,16 +865,17 @@ func getPulse(r rows.FlatRow, peak float64, color leds.Color) map[rows.Coord]led
 	return pulse
 }
 
-// peakToFloatPixel converts a peak [0-16) to a float pixel value [0-143].
-// 0 <= peak < 16
-func peakToFloatPixel(r rows.FlatRow, peak float64) float64 {
+// peakToFloatPixel converts a peak [0-columns) to a float pixel value [0-143].
+// The pulse wraps from the last column in use back to the first.
+// 0 <= peak < columns
+func peakToFloatPixel(r rows.FlatRow, peak float64, columns int) float64 {
 	// assume peak == 12.7
 	beat1 := math.Floor(peak) // 12 // 15
 	beat2 := math.Ceil(peak)  // 13 // 16
-	if beat1 == program.Cols {
+	if beat1 >= float64(columns) {
 		beat1 = 0.0
 	}
-	if beat2 == program.Cols {
+	if beat2 >= float64(columns) {
 		beat2 = 0.0
 	}
 
@@ -0,0 +1,393 @@
+package beats
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/midi"
+	"github.com/siggy/bbox/pkg/program"
+)
+
+type memStore struct {
+	mu        sync.Mutex
+	snapshots map[string]Snapshot
+	saves     int
+}
+
+var (
+	kick   = program.Coord{Row: 0, Col: 0}
+	sounds = [program.Rows]string{"kick.wav", "snare.wav", "hihat.wav", "clap.wav"}
+)
+
+func TestTempoReset(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	start := fake.Now()
+	resetAt := start.Add(2 * time.Second)
+
+	// restore a pattern of quarter notes at 90 bpm, returning to 120 bpm
+	snapshot := Snapshot{BPM: 90, TempoReset: resetAt}
+	for col := 0; col < program.Cols; col += defaultStepsPerBeat {
+		snapshot.Grid[0][col] = Normal
+		snapshot.Decays = append(snapshot.Decays, Decay{Coord: program.Coord{Row: 0, Col: col}, At: start.Add(time.Hour)})
+	}
+	store := &memStore{snapshots: map[string]Snapshot{"tempo": snapshot}}
+
+	b := New(Preset{Name: "tempo", BPM: 120}, WithClock(fake), WithStore(store))(context.Background()).(*beats)
+	defer b.Close()
+	waitFor(t, "the restored grid", func() bool { return b.Grid()[0][0] })
+
+	var kicks []time.Time
+	for _, sound := range advance(t, fake, b, 5*time.Second) {
+		kicks = append(kicks, sound.At)
+	}
+
+	slow := quarter(90)
+	fast := quarter(120)
+
+	var before, after int
+	for i := 1; i < len(kicks); i++ {
+		from, to := kicks[i-1], kicks[i]
+		interval := to.Sub(from)
+
+		switch {
+		case !to.After(resetAt):
+			before++
+			if !nearDuration(interval, slow) {
+				t.Errorf("kick at %v came %v after the last, want %v before the tempo reset", to.Sub(start), interval, slow)
+			}
+		case from.After(resetAt.Add(lookahead + tickInterval)):
+			// steps scheduled ahead of the reset keep their time
+			after++
+			if !nearDuration(interval, fast) {
+				t.Errorf("kick at %v came %v after the last, want %v after the tempo reset", to.Sub(start), interval, fast)
+			}
+		default:
+			if interval < fast-time.Microsecond || interval > slow+time.Microsecond {
+				t.Errorf("kick at %v came %v after the last, want between %v and %v across the tempo reset", to.Sub(start), interval, fast, slow)
+			}
+		}
+	}
+
+	if before < 2 || after < 2 {
+		t.Errorf("heard %d intervals before the tempo reset and %d after, want at least 2 of each", before, after)
+	}
+}
+
+func TestDecay(t *testing.T) {
+	testCases := []struct {
+		name      string
+		decay     time.Duration
+		keepAlive time.Duration
+	}{
+		{"short", time.Second, 500 * time.Millisecond},
+		{"long", 3 * time.Second, time.Second},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Unix(0, 0))
+			start := fake.Now()
+
+			b := New(Preset{
+				Name:         tc.name,
+				Sounds:       sounds,
+				BPM:          120,
+				StarterBeats: []Step{{Coord: kick}},
+				Decay:        tc.decay,
+				KeepAlive:    tc.keepAlive,
+			}, WithClock(fake))(context.Background()).(*beats)
+			defer b.Close()
+			waitFor(t, "the starter beat", func() bool { return b.Grid()[0][0] })
+
+			played := advance(t, fake, b, tc.decay-tickInterval)
+			if !b.Grid()[0][0] {
+				t.Fatal("beat off before its decay")
+			}
+			if !heard(played, 0) {
+				t.Error("beat not heard before its decay")
+			}
+
+			advance(t, fake, b, tickInterval)
+			waitFor(t, "the beat to decay", func() bool { return !b.Grid()[0][0] })
+
+			// only steps scheduled ahead of the decay play after it
+			for _, sound := range advance(t, fake, b, tc.keepAlive-tickInterval) {
+				if sound.At.After(start.Add(tc.decay + lookahead)) {
+					t.Errorf("heard %s at %v, after its decay", sound.Name, sound.At.Sub(start))
+				}
+			}
+			if b.Grid()[1][0] {
+				t.Fatal("keep alive beat before its time")
+			}
+
+			advance(t, fake, b, tickInterval)
+			waitFor(t, "the keep alive beat", func() bool { return b.Grid()[1][0] })
+
+			if !heard(advance(t, fake, b, tc.decay), 1) {
+				t.Error("keep alive beat not heard")
+			}
+		})
+	}
+}
+
+func TestSaves(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	store := &memStore{snapshots: map[string]Snapshot{}}
+
+	b := New(Preset{Name: "saves", BPM: 120, StarterBeats: []Step{{Coord: kick}}}, WithClock(fake), WithStore(store))(context.Background()).(*beats)
+	waitFor(t, "the starter beat", func() bool { return b.Grid()[0][0] })
+
+	advance(t, fake, b, saveDelay-tickInterval)
+	if saves := store.count(); saves != 0 {
+		t.Fatalf("saved %d times before the save delay, want 0", saves)
+	}
+	advance(t, fake, b, tickInterval)
+	waitFor(t, "the starter beat to save", func() bool { return store.count() == 1 })
+
+	// a burst of presses waits for the next save
+	for col := 1; col < 4; col++ {
+		b.Press(program.Coord{Row: 2, Col: col})
+		waitFor(t, "the press", func() bool { return b.Grid()[2][col] })
+	}
+	if saves := store.count(); saves != 1 {
+		t.Fatalf("saved %d times after a burst of presses, want 1", saves)
+	}
+
+	// closing saves what is left
+	b.Close()
+	if saves := store.count(); saves != 2 {
+		t.Fatalf("saved %d times after Close, want 2", saves)
+	}
+	if snapshot := store.snapshots["saves"]; snapshot.Grid[2][3] != Normal {
+		t.Errorf("saved %v for the last press, want %v", snapshot.Grid[2][3], Normal)
+	}
+}
+
+func TestTempoKey(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	b := New(Preset{Name: "tempo key", BPM: 120}, WithClock(fake))(context.Background()).(*beats)
+	defer b.Close()
+	waitFor(t, "the program to start", func() bool { return fake.Pending() > 0 })
+	pending := fake.Pending()
+
+	// a single press edits its step once a second press can no longer follow
+	b.Press(tempoKey)
+	waitFor(t, "the press to be held", func() bool { return fake.Pending() == pending+1 })
+	advance(t, fake, b, doublePress-tickInterval)
+	if b.Grid()[tempoKey.Row][tempoKey.Col] {
+		t.Fatal("tempo key edited its step before a second press could follow")
+	}
+	advance(t, fake, b, tickInterval)
+	waitFor(t, "the step to be edited", func() bool { return b.Grid()[tempoKey.Row][tempoKey.Col] })
+
+	// a double press enters tempo mode, without editing the grid
+	before := b.Grid()
+	pending = fake.Pending()
+	b.Press(tempoKey)
+	waitFor(t, "the press to be held", func() bool { return fake.Pending() == pending+1 })
+	advance(t, fake, b, doublePress/2)
+	b.Press(tempoKey)
+	waitFor(t, "tempo mode", func() bool { return fake.Pending() == pending })
+
+	// typed digits don't edit the grid either
+	for _, col := range []int{9, 0} {
+		b.Press(program.Coord{Row: digitRow, Col: col})
+	}
+	b.Press(enterKey)
+	advance(t, fake, b, doublePress)
+
+	if got := b.Grid(); got != before {
+		t.Errorf("tempo mode edited the grid:\n%v\nwant:\n%v", got, before)
+	}
+}
+
+func TestStepDuration(t *testing.T) {
+	testCases := []struct {
+		name         string
+		steps        int
+		stepsPerBeat int
+		swing        float64
+	}{
+		{"straight", 16, 4, minSwing},
+		{"swung", 16, 4, 66},
+		{"swung triplets", 12, 3, 60},
+		{"swung odd pattern", 15, 4, 66},
+		{"swung odd pattern of triplets", 13, 3, 60},
+	}
+
+	const bpm = 120
+	beat := time.Minute / bpm
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Preset{BPM: bpm, Steps: tc.steps, StepsPerBeat: tc.stepsPerBeat, Swing: tc.swing}.withDefaults()
+
+			// every beat lasts as long as the tempo says, and the pattern as
+			// long as its straight steps
+			var pattern, length time.Duration
+			for step := range p.Steps {
+				d := stepDuration(bpm, p, step)
+				pattern += d
+				length += d
+				if (step+1)%p.StepsPerBeat == 0 {
+					if !nearDuration(length, beat) {
+						t.Errorf("beat ending on step %d lasts %v, want %v", step, length, beat)
+					}
+					length = 0
+				}
+			}
+			if want := beat * time.Duration(p.Steps) / time.Duration(p.StepsPerBeat); !nearDuration(pattern, want) {
+				t.Errorf("pattern lasts %v, want %v", pattern, want)
+			}
+		})
+	}
+}
+
+func TestMIDIClocks(t *testing.T) {
+	testCases := []struct {
+		name         string
+		stepsPerBeat int
+		swing        float64
+	}{
+		{"straight", 4, minSwing},
+		{"swung", 4, 66},
+		{"triplets", 3, minSwing},
+		{"swung triplets", 3, 60},
+		{"swung sixes", 6, 58},
+	}
+
+	const bpm = 120
+	interval := time.Minute / time.Duration(bpm*midi.PPQN)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Preset{BPM: bpm, Steps: 4 * tc.stepsPerBeat, StepsPerBeat: tc.stepsPerBeat, Swing: tc.swing}.withDefaults()
+
+			// schedule two bars like run does
+			var clocks []time.Time
+			at := time.Unix(0, 0)
+			clockAt := at
+			for step := range 2 * p.Steps {
+				step %= p.Steps
+				if step%p.StepsPerBeat == 0 {
+					clockAt = at
+				}
+				var stepClocks []time.Time
+				stepClocks, clockAt = midiClocks(p, step, bpm, clockAt)
+				clocks = append(clocks, stepClocks...)
+				at = at.Add(stepDuration(bpm, p, step))
+			}
+
+			if want := 2 * p.Steps / p.StepsPerBeat * midi.PPQN; len(clocks) != want {
+				t.Fatalf("sent %d clocks, want %d", len(clocks), want)
+			}
+			// swing doesn't move the clock
+			for i := 1; i < len(clocks); i++ {
+				if got := clocks[i].Sub(clocks[i-1]); !nearDuration(got, interval) {
+					t.Fatalf("clock %d came %v after the last, want %v", i, got, interval)
+				}
+			}
+		})
+	}
+}
+
+// advance moves the clock on by d a tick at a time, waiting for the program
+// to render each tick, and returns the sounds it scheduled.
+func advance(t *testing.T, fake *clock.Fake, b *beats, d time.Duration) []program.Sound {
+	t.Helper()
+
+	var sounds []program.Sound
+	for range d / tickInterval {
+		fake.Advance(tickInterval)
+
+		// a tick renders every row, a changed step only its own button
+		for frame := false; !frame; {
+			select {
+			case state := <-b.Render():
+				frame = len(state) > 0 && len(state[0]) > 1
+			case <-time.After(time.Second):
+				t.Fatal("tick not rendered")
+			}
+		}
+
+		// a tick schedules its sounds before rendering
+		for drained := false; !drained; {
+			select {
+			case sound := <-b.Play():
+				sounds = append(sounds, sound)
+			default:
+				drained = true
+			}
+		}
+	}
+
+	return sounds
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !done(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// heard reports whether any of sounds came from row.
+func heard(played []program.Sound, row int) bool {
+	for _, sound := range played {
+		if sound.Name == sounds[row] {
+			return true
+		}
+	}
+	return false
+}
+
+func quarter(bpm int) time.Duration {
+	var d time.Duration
+	for step := range defaultStepsPerBeat {
+		d += stepDuration(bpm, Preset{StepsPerBeat: defaultStepsPerBeat, Swing: minSwing}, step)
+	}
+	return d
+}
+
+func nearDuration(got, want time.Duration) bool {
+	return got >= want-time.Microsecond && got <= want+time.Microsecond
+}
+
+func (s *memStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saves
+}
+
+func (s *memStore) Load(name string) (Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[name]
+	return snapshot, ok, nil
+}
+
+func (s *memStore) Save(name string, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots[name] = snapshot
+	s.saves++
+	return nil
+}
+
+func (s *memStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.snapshots, name)
+	return nil
+}
@@ -0,0 +1,103 @@
+package beats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Level is the velocity of a step.
+type Level uint8
+
+const (
+	Off Level = iota
+	Soft
+	Normal
+	Accent
+)
+
+var levelNames = [...]string{
+	Off:    "off",
+	Soft:   "soft",
+	Normal: "normal",
+	Accent: "accent",
+}
+
+// ParseLevel parses a level name, as returned by Level.String.
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if n == name {
+			return Level(level), nil
+		}
+	}
+	return Off, fmt.Errorf("unknown level %q", name)
+}
+
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// next is the level a press moves a step to: off, normal, accent, soft and
+// back to off.
+func (l Level) next() Level {
+	switch l {
+	case Off:
+		return Normal
+	case Normal:
+		return Accent
+	case Accent:
+		return Soft
+	default:
+		return Off
+	}
+}
+
+// gain is the playback volume for a step at this level.
+func (l Level) gain() float64 {
+	switch l {
+	case Soft:
+		return 0.35
+	case Normal:
+		return 0.7
+	case Accent:
+		return 1.0
+	default:
+		return 0
+	}
+}
+
+// velocity is the MIDI velocity for a step at this level.
+func (l Level) velocity() uint8 {
+	return uint8(math.Round(l.gain() * 127))
+}
+
+// brightness scales beatColor for a step at this level.
+func (l Level) brightness() float64 {
+	switch l {
+	case Soft:
+		return 0.2
+	case Normal:
+		return 0.6
+	case Accent:
+		return 1.0
+	default:
+		return 0
+	}
+}
+
+// UnmarshalJSON rejects levels out of range.
+func (l *Level) UnmarshalJSON(b []byte) error {
+	var level uint8
+	if err := json.Unmarshal(b, &level); err != nil {
+		return fmt.Errorf("invalid level %s: %w", b, err)
+	}
+	if int(level) >= len(levelNames) {
+		return fmt.Errorf("invalid level %d", level)
+	}
+
+	*l = Level(level)
+	return nil
+}
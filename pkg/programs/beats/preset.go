@@ -0,0 +1,209 @@
+package beats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/midi"
+	"github.com/siggy/bbox/pkg/program"
+)
+
+// Preset describes a beats program: its look, its sounds, and the groove it
+// starts with.
+type Preset struct {
+	Name       string
+	BeatColor  leds.Color
+	PulseColor leds.Color
+	Sounds     [program.Rows]string
+	// Pan places each row's sound between -1 (left) and 1 (right)
+	Pan [program.Rows]float64
+	// Choke puts rows in groups that cut each other off, e.g. closed and open
+	// hi-hats, 0 for none
+	Choke [program.Rows]int
+	// Notes are the General MIDI drum notes each row sends with WithMIDI, 0
+	// guesses from the sound's name, e.g. kick-808.wav is a kick
+	Notes [program.Rows]uint8
+	// StarterBeats are played when there is no saved grid
+	StarterBeats []Step
+	BPM          int
+	// BeatLimit is the number of active steps that yields to the next program,
+	// defaults to 75% of all steps
+	BeatLimit int
+
+	// Steps is the pattern length, defaults to program.Cols. Patterns longer
+	// than program.Cols are split into pages of program.Cols steps, the
+	// buttons show and edit the page currently playing. Shorter patterns
+	// leave the remaining columns dark.
+	Steps int
+	// StepsPerBeat defaults to 4, sixteenth notes. Use 3 for triplet feels,
+	// e.g. 12 steps of 3 for 12/8, or 12 steps of 6 for 6/8.
+	StepsPerBeat int
+	// Swing is the share of each pair of steps within a beat given to the
+	// first one, as a percentage. 50 (or 0) is straight, 66 is a triplet
+	// shuffle. A step left without a pair, at the end of an odd beat or
+	// pattern, is straight.
+	Swing float64
+
+	// SyncTempo follows the tempo of music in the room, or of a MIDI clock
+	// master, when there is one, see program.TempoProgram
+	SyncTempo bool
+
+	// Decay turns a step off this long after it last changed, defaults to 3
+	// minutes
+	Decay time.Duration
+	// KeepAlive adds a beat this long after the grid empties, defaults to 14
+	// minutes
+	KeepAlive time.Duration
+	// TempoDecay returns a changed tempo to BPM after this long, defaults to
+	// 3 minutes
+	TempoDecay time.Duration
+}
+
+// Step is a step in the pattern, Col is the step index. A zero Level is
+// Normal.
+type Step struct {
+	program.Coord
+	Level Level
+}
+
+const (
+	MaxSteps = 2 * program.Cols
+
+	defaultStepsPerBeat = 4
+	defaultDecay        = 3 * time.Minute
+	defaultKeepAlive    = 14 * time.Minute
+	defaultTempoDecay   = 3 * time.Minute
+	minSwing            = 50
+	maxSwing            = 75
+)
+
+// Validate checks the preset's pattern settings.
+func (p Preset) Validate() error {
+	if p.BPM < minBPM || p.BPM > maxBPM {
+		return fmt.Errorf("bpm must be between %d and %d: %d", minBPM, maxBPM, p.BPM)
+	}
+	if p.Steps < 0 || p.Steps > MaxSteps {
+		return fmt.Errorf("steps must be between 1 and %d, or 0 for %d: %d", MaxSteps, program.Cols, p.Steps)
+	}
+	if p.StepsPerBeat < 0 {
+		return fmt.Errorf("invalid stepsPerBeat: %d", p.StepsPerBeat)
+	}
+	if p.Swing != 0 && (p.Swing < minSwing || p.Swing > maxSwing) {
+		return fmt.Errorf("swing must be between %d and %d: %v", minSwing, maxSwing, p.Swing)
+	}
+
+	for row, pan := range p.Pan {
+		if pan < -1 || pan > 1 {
+			return fmt.Errorf("pan for row %d must be between -1 and 1: %v", row, pan)
+		}
+	}
+
+	if p.Decay < 0 || p.KeepAlive < 0 || p.TempoDecay < 0 {
+		return fmt.Errorf("decay, keepAlive and tempoDecay must not be negative: %v, %v, %v", p.Decay, p.KeepAlive, p.TempoDecay)
+	}
+
+	steps := p.withDefaults().Steps
+	if p.BeatLimit < 0 || p.BeatLimit > program.Rows*steps {
+		return fmt.Errorf("invalid beatLimit: %d", p.BeatLimit)
+	}
+	for row, note := range p.Notes {
+		if note > midi.MaxNote {
+			return fmt.Errorf("note for row %d must be at most %d: %d", row, midi.MaxNote, note)
+		}
+	}
+
+	for _, step := range p.StarterBeats {
+		if step.Row < 0 || step.Row >= program.Rows || step.Col < 0 || step.Col >= steps {
+			return fmt.Errorf("beat out of range: %+v", step.Coord)
+		}
+		if step.Level > Accent {
+			return fmt.Errorf("invalid level for beat %+v: %d", step.Coord, step.Level)
+		}
+	}
+
+	return nil
+}
+
+func (p Preset) withDefaults() Preset {
+	if p.Steps == 0 {
+		p.Steps = program.Cols
+	}
+	if p.StepsPerBeat == 0 {
+		p.StepsPerBeat = defaultStepsPerBeat
+	}
+	if p.Swing == 0 {
+		p.Swing = minSwing
+	}
+	if p.BeatLimit == 0 {
+		p.BeatLimit = program.Rows * p.Steps * 3 / 4
+	}
+	if p.Decay == 0 {
+		p.Decay = defaultDecay
+	}
+	if p.KeepAlive == 0 {
+		p.KeepAlive = defaultKeepAlive
+	}
+	if p.TempoDecay == 0 {
+		p.TempoDecay = defaultTempoDecay
+	}
+	for row, note := range p.Notes {
+		if note == 0 {
+			p.Notes[row] = midi.DrumNote(p.Sounds[row])
+		}
+	}
+
+	starterBeats := make([]Step, len(p.StarterBeats))
+	for i, step := range p.StarterBeats {
+		if step.Level == Off {
+			step.Level = Normal
+		}
+		starterBeats[i] = step
+	}
+	p.StarterBeats = starterBeats
+
+	return p
+}
+
+// columns is the number of buttons in use per page.
+func (p Preset) columns() int {
+	return min(p.Steps, program.Cols)
+}
+
+// Score returns the sounds the preset's starter beats play over bars passes
+// through the pattern, starting at start, and the time the last pass ends. It
+// follows the same timing as the running program, for offline rendering.
+func (p Preset) Score(start time.Time, bars int) ([]program.Sound, time.Time) {
+	p = p.withDefaults()
+
+	pattern := state{}
+	for _, step := range p.StarterBeats {
+		pattern[step.Row][step.Col] = step.Level
+	}
+
+	var sounds []program.Sound
+	at := start
+	for range bars {
+		for step := range p.Steps {
+			for row := range pattern {
+				if level := pattern[row][step]; level != Off {
+					sounds = append(sounds, p.sound(row, level, at))
+				}
+			}
+			at = at.Add(stepDuration(p.BPM, p, step))
+		}
+	}
+
+	return sounds, at
+}
+
+// sound is a row's sound at level, to play at at.
+func (p Preset) sound(row int, level Level, at time.Time) program.Sound {
+	return program.Sound{
+		Name:  p.Sounds[row],
+		Gain:  level.gain(),
+		Pan:   p.Pan[row],
+		Choke: p.Choke[row],
+		At:    at,
+	}
+}
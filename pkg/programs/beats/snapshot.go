@@ -0,0 +1,145 @@
+package beats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/siggy/bbox/pkg/program"
+)
+
+type (
+	// Snapshot is the state of a beats program worth keeping across program
+	// switches and restarts.
+	Snapshot struct {
+		Grid [program.Rows][MaxSteps]Level `json:"grid"`
+		BPM  int                           `json:"bpm"`
+
+		// Decays are when active beats turn themselves off
+		Decays []Decay `json:"decays"`
+		// TempoReset is when BPM returns to the preset's BPM, zero if it is
+		// already there
+		TempoReset time.Time `json:"tempoReset"`
+	}
+
+	Decay struct {
+		program.Coord
+		At time.Time `json:"at"`
+	}
+
+	// Store persists snapshots by preset name.
+	Store interface {
+		Load(name string) (Snapshot, bool, error)
+		Save(name string, snapshot Snapshot) error
+		Delete(name string) error
+	}
+
+	fileStore struct {
+		path string
+
+		mu        sync.Mutex
+		snapshots map[string]Snapshot
+	}
+)
+
+// NewFileStore keeps every preset's snapshot in a single JSON file.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{
+		path:      path,
+		snapshots: map[string]Snapshot{},
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(b, &s.snapshots); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+func (s *fileStore) Load(name string) (Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, ok := s.snapshots[name]
+	return snapshot, ok, nil
+}
+
+func (s *fileStore) Save(name string, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots[name] = snapshot
+	return s.write()
+}
+
+func (s *fileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.snapshots, name)
+	return s.write()
+}
+
+// write replaces the file atomically, so a power cut leaves either the old or
+// the new snapshots.
+func (s *fileStore) write() error {
+	b, err := json.MarshalIndent(s.snapshots, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshots: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir for %s: %w", s.path, err)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	// the data must be on disk before the rename is, or a power cut may
+	// leave an empty file
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+
+	// sync the rename itself
+	dir, err := os.Open(filepath.Dir(s.path))
+	if err != nil {
+		return fmt.Errorf("failed to open dir for %s: %w", s.path, err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dir for %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func (s Snapshot) empty() bool {
+	grid := state(s.Grid)
+	return grid.allOff()
+}
@@ -0,0 +1,55 @@
+package beats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/program"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "beats.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	want := Snapshot{BPM: 90, TempoReset: time.Unix(100, 0).UTC()}
+	want.Grid[1][2] = Accent
+	want.Decays = []Decay{{Coord: program.Coord{Row: 1, Col: 2}, At: time.Unix(200, 0).UTC()}}
+
+	if err := store.Save("a", want); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Save("b", Snapshot{BPM: 120}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Delete("b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+
+	// a new store reads what the last one wrote
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	got, ok, err := store.Load("a")
+	if err != nil || !ok {
+		t.Fatalf("Load failed: %t, %v", ok, err)
+	}
+	if got.Grid != want.Grid || got.BPM != want.BPM || !got.TempoReset.Equal(want.TempoReset) ||
+		len(got.Decays) != 1 || got.Decays[0].Coord != want.Decays[0].Coord || !got.Decays[0].At.Equal(want.Decays[0].At) {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+
+	if _, ok, _ := store.Load("b"); ok {
+		t.Error("loaded a deleted snapshot")
+	}
+}
@@ -2,16 +2,19 @@ package beats
 
 import "github.com/siggy/bbox/pkg/program"
 
-type state [program.Rows][program.Cols]bool
+type state [program.Rows][MaxSteps]Level
 
 func (s state) String() string {
 	var str string
 	for row := range program.Rows {
 		for col := range s[row] {
-			if s[row][col] {
-				str += "X"
-			} else {
+			switch s[row][col] {
+			case Off:
 				str += "."
+			case Soft:
+				str += "x"
+			default:
+				str += "X"
 			}
 		}
 		str += "\n"
@@ -24,7 +27,7 @@ func (s state) activeButtons() int {
 
 	for _, row := range s {
 		for _, beat := range row {
-			if beat {
+			if beat != Off {
 				active++
 			}
 		}
@@ -33,10 +36,22 @@ func (s state) activeButtons() int {
 	return active
 }
 
+// page returns which of the program.Cols steps starting at page*program.Cols
+// are on.
+func (s state) page(page int) program.Grid {
+	grid := program.Grid{}
+	for row := range s {
+		for col := range program.Cols {
+			grid[row][col] = s[row][page*program.Cols+col] != Off
+		}
+	}
+	return grid
+}
+
 func (s *state) allOff() bool {
 	for _, row := range s {
 		for _, beat := range row {
-			if beat {
+			if beat != Off {
 				return false
 			}
 		}
@@ -0,0 +1,163 @@
+package beats
+
+import (
+	"math"
+	"time"
+
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/rows"
+)
+
+type (
+	// tempoControl is tempo mode, entered by double-pressing tempoKey. While
+	// it is active, presses set the tempo instead of editing the grid:
+	// tempoKey taps the tempo, the digit keys on digitRow type it in, and
+	// enterKey sets what was typed. Pressing rows below digitRow, or leaving
+	// it alone for tempoModeTimeout, returns to the grid.
+	tempoControl struct {
+		active bool
+		// last is the time of the last press in tempo mode
+		last time.Time
+
+		taps   []time.Time
+		digits []int
+	}
+)
+
+const (
+	// doublePress is the most time between two presses of tempoKey that
+	// enters tempo mode, a single press edits its step once it has passed
+	doublePress      = 400 * time.Millisecond
+	tempoModeTimeout = 5 * time.Second
+
+	// taps further apart than maxTapInterval start a new tempo, and the last
+	// maxTaps are averaged
+	maxTapInterval = 2 * time.Second
+	maxTaps        = 5
+
+	digitRow = 1
+	// digits are typed on columns 0 to 9
+	digitKeys = 10
+	maxDigits = 3
+)
+
+var (
+	tempoKey = program.Coord{Row: 0, Col: program.Cols - 1}
+	enterKey = program.Coord{Row: digitRow, Col: program.Cols - 1}
+)
+
+func (t *tempoControl) enter(now time.Time) {
+	*t = tempoControl{active: true, last: now}
+}
+
+func (t *tempoControl) exit() {
+	*t = tempoControl{}
+}
+
+// expired reports whether tempo mode has been left alone for long enough to
+// return to the grid.
+func (t *tempoControl) expired(now time.Time) bool {
+	return t.active && now.Sub(t.last) > tempoModeTimeout
+}
+
+// press handles a press in tempo mode. It returns a new tempo, or 0 if the
+// press did not set one.
+func (t *tempoControl) press(press program.Coord, now time.Time) int {
+	t.last = now
+
+	switch {
+	case press == tempoKey:
+		return t.tap(now)
+
+	case press == enterKey:
+		return t.commit()
+
+	case press.Row == digitRow && press.Col < digitKeys:
+		t.digits = append(t.digits, press.Col)
+
+		// set the tempo as soon as another digit could not make it valid
+		if len(t.digits) == maxDigits || t.typed()*10 > maxBPM {
+			return t.commit()
+		}
+
+	case press.Row > digitRow:
+		t.exit()
+	}
+
+	return 0
+}
+
+// tap adds a tap, and returns the tempo of the taps so far.
+func (t *tempoControl) tap(now time.Time) int {
+	if len(t.taps) > 0 && now.Sub(t.taps[len(t.taps)-1]) > maxTapInterval {
+		t.taps = nil
+	}
+	t.taps = append(t.taps, now)
+	if len(t.taps) > maxTaps {
+		t.taps = t.taps[len(t.taps)-maxTaps:]
+	}
+
+	if len(t.taps) < 2 {
+		return 0
+	}
+
+	interval := t.taps[len(t.taps)-1].Sub(t.taps[0]) / time.Duration(len(t.taps)-1)
+	bpm := int(math.Round(float64(time.Minute) / float64(interval)))
+	return max(minBPM, min(maxBPM, bpm))
+}
+
+// commit returns the typed tempo, if valid, and clears it.
+func (t *tempoControl) commit() int {
+	bpm := t.typed()
+	t.digits = nil
+
+	if bpm < minBPM || bpm > maxBPM {
+		return 0
+	}
+	return bpm
+}
+
+func (t *tempoControl) typed() int {
+	value := 0
+	for _, digit := range t.digits {
+		value = value*10 + digit
+	}
+	return value
+}
+
+// render shows the tempo on the buttons, one digit per row from digitRow
+// down, each lit at the digit's column. While digits are being typed, they
+// show instead. tempoKey lights up on the beat.
+func (t *tempoControl) render(bpm int, onBeat bool, p Preset) leds.State {
+	ledsState := leds.State{}
+	for _, row := range rows.FlatRows {
+		for _, pixel := range row.Pixels {
+			ledsState.Set(pixel.Strip, pixel.Pixel, leds.Black)
+		}
+	}
+
+	button := func(c program.Coord, color leds.Color) {
+		row := rows.FlatRows[c.Row]
+		pixel := row.Pixels[row.Buttons[c.Col]]
+		ledsState.Set(pixel.Strip, pixel.Pixel, color)
+	}
+
+	digits := t.digits
+	if len(digits) == 0 {
+		for value := bpm; value > 0 || len(digits) == 0; value /= 10 {
+			digits = append([]int{value % 10}, digits...)
+		}
+	}
+	for i, digit := range digits {
+		if row := digitRow + i; row < program.Rows {
+			button(program.Coord{Row: row, Col: digit}, p.BeatColor)
+		}
+	}
+
+	if onBeat {
+		button(tempoKey, p.PulseColor)
+	}
+
+	return ledsState
+}
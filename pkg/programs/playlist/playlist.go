@@ -0,0 +1,291 @@
+package playlist
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/programs/song"
+	"github.com/siggy/bbox/pkg/rows"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Playlist declares the songs a playlist program plays.
+	Playlist struct {
+		Name  string
+		Songs []string
+		// Dir is a directory in the wavs directory, every song in it plays
+		// after Songs
+		Dir     string
+		Shuffle bool
+	}
+
+	playlistProgram struct {
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		in     chan program.Coord
+		eq     chan equalizer.DisplayData
+		render chan leds.State
+		yield  chan struct{}
+
+		playlist Playlist
+		tracks   program.Tracks
+
+		log *log.Entry
+	}
+)
+
+const (
+	pressThreshold = 10
+
+	// presses on controlRow skip back, pause or skip forward, by column
+	controlRow   = 0
+	previousCols = 5
+	nextCols     = 5
+
+	// previous restarts the current song, unless it has only just started
+	restartAfter = 3 * time.Second
+)
+
+var progressColor = leds.White
+
+// New plays the songs in p, one after another, until enough buttons are
+// pressed to yield.
+func New(p Playlist, tracks program.Tracks) program.ProgramFactory {
+	return func(ctx context.Context) program.Program {
+		log := log.WithFields(log.Fields{"program": "playlist", "playlist": p.Name})
+		log.Debug("New")
+
+		ctx, cancel := context.WithCancel(ctx)
+		l := &playlistProgram{
+			ctx:    ctx,
+			cancel: cancel,
+
+			in:     make(chan program.Coord, program.ChannelBuffer),
+			eq:     make(chan equalizer.DisplayData, program.ChannelBuffer),
+			render: make(chan leds.State, program.ChannelBuffer),
+			yield:  make(chan struct{}, program.ChannelBuffer),
+
+			playlist: p,
+			tracks:   tracks,
+
+			log: log,
+		}
+
+		l.wg.Add(1)
+		go l.run()
+
+		return l
+	}
+}
+
+func (p *playlistProgram) Name() string {
+	return p.playlist.Name
+}
+
+func (p *playlistProgram) Close() {
+	p.cancel()
+	p.wg.Wait()
+	close(p.render)
+}
+
+func (p *playlistProgram) Press(press program.Coord) {
+	p.log.Debugf("Press: %+v", press)
+
+	select {
+	case <-p.ctx.Done():
+		return
+	default:
+	}
+
+	// enqueue input non-blockingly
+	select {
+	case p.in <- press:
+	default:
+	}
+}
+
+func (p *playlistProgram) EQ(displayData equalizer.DisplayData) {
+	p.log.Tracef("EQ: %+v", displayData)
+
+	select {
+	case <-p.ctx.Done():
+		return
+	default:
+	}
+
+	// enqueue input non-blockingly
+	select {
+	case p.eq <- displayData:
+	default:
+	}
+}
+
+func (p *playlistProgram) Play() <-chan program.Sound {
+	return nil
+}
+func (p *playlistProgram) PlayWithEQ() <-chan string {
+	return nil
+}
+func (p *playlistProgram) Render() <-chan leds.State {
+	return p.render
+}
+func (p *playlistProgram) Yield() <-chan struct{} {
+	return p.yield
+}
+
+func (p *playlistProgram) run() {
+	defer p.wg.Done()
+
+	songs := p.songs()
+	if len(songs) == 0 {
+		p.log.Warn("No songs to play")
+		p.yield <- struct{}{}
+		return
+	}
+
+	visualizer := song.NewVisualizer()
+
+	cur := 0
+	var track program.Track
+
+	// play starts songs[i], moving on by step past songs that fail to play
+	play := func(i, step int) bool {
+		if track != nil {
+			track.Close()
+		}
+
+		for range songs {
+			i = (i + len(songs)) % len(songs)
+
+			var err error
+			track, err = p.tracks.PlayTrack(songs[i])
+			if err == nil {
+				p.log.Debugf("Playing %s (%s)", songs[i], track.Duration())
+				cur = i
+				return true
+			}
+
+			p.log.Errorf("play %s failed: %v", songs[i], err)
+			i += step
+		}
+
+		track = nil
+		return false
+	}
+
+	if !play(0, 1) {
+		p.yield <- struct{}{}
+		return
+	}
+	defer func() {
+		if track != nil {
+			track.Close()
+		}
+	}()
+
+	presses := 0
+	paused := false
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+
+		case <-track.Done():
+			if !play(cur+1, 1) {
+				p.yield <- struct{}{}
+				return
+			}
+			paused = false
+
+		case press := <-p.in:
+			p.log.Debugf("Processing press: %+v", press)
+
+			if press.Row == controlRow {
+				ok := true
+				switch {
+				case press.Col < previousCols:
+					if track.Position() > restartAfter {
+						track.Seek(0)
+					} else {
+						ok = play(cur-1, -1)
+					}
+					paused = false
+				case press.Col >= program.Cols-nextCols:
+					ok = play(cur+1, 1)
+					paused = false
+				case paused:
+					track.Resume()
+					paused = false
+				default:
+					track.Pause()
+					paused = true
+				}
+
+				if !ok {
+					p.yield <- struct{}{}
+					return
+				}
+				continue
+			}
+
+			presses++
+
+			if presses >= pressThreshold {
+				p.yield <- struct{}{}
+				return
+			}
+
+		case displayData := <-p.eq:
+			p.log.Tracef("Processing EQ: %+v", displayData)
+
+			state := visualizer.Render(displayData)
+			if duration := track.Duration(); duration > 0 {
+				drawProgress(state, float64(track.Position())/float64(duration))
+			}
+
+			p.render <- state
+		}
+	}
+}
+
+// songs lists every song in the playlist, shuffled if requested.
+func (p *playlistProgram) songs() []string {
+	songs := append([]string{}, p.playlist.Songs...)
+
+	if p.playlist.Dir != "" {
+		dir, err := p.tracks.ListTracks(p.playlist.Dir)
+		if err != nil {
+			p.log.Errorf("ListTracks failed: %v", err)
+		}
+		songs = append(songs, dir...)
+	}
+
+	if p.playlist.Shuffle {
+		rand.Shuffle(len(songs), func(i, j int) {
+			songs[i], songs[j] = songs[j], songs[i]
+		})
+	}
+
+	return songs
+}
+
+// drawProgress sweeps a pixel around every row, from the first button at the
+// start of the song back around to it at the end.
+func drawProgress(state leds.State, progress float64) {
+	progress = max(0, min(1, progress))
+
+	for _, row := range rows.FlatRows {
+		offset := int(progress * float64(len(row.Pixels)))
+		pixel := row.Pixels[(row.Buttons[0]+offset)%len(row.Pixels)]
+		state.Set(pixel.Strip, pixel.Pixel, progressColor)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/siggy/bbox/pkg/equalizer"
 	"github.com/siggy/bbox/pkg/leds"
 	"github.com/siggy/bbox/pkg/program"
-	"github.com/siggy/bbox/pkg/rows"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,26 +19,27 @@ type (
 
 		in     chan program.Coord
 		eq     chan equalizer.DisplayData
-		play   chan string
 		render chan leds.State
 		yield  chan struct{}
 
 		song   string
-		length time.Duration
+		tracks program.Tracks
 
 		log *log.Entry
 	}
 )
 
 const (
-	// practically disable color rotation
-	ticksPerColorRotation = 10000000 // 60
-	pressThreshold        = 10
+	pressThreshold = 10
+
+	// presses on scrubRow seek through the song, col 0 is the start
+	scrubRow = 1
 )
 
-func New(song string, length time.Duration) program.ProgramFactory {
+// New plays song from tracks, and yields once it finishes.
+func New(song string, tracks program.Tracks) program.ProgramFactory {
 	return func(ctx context.Context) program.Program {
-		log := log.WithFields(log.Fields{"program": "song", "song": song, "length": length})
+		log := log.WithFields(log.Fields{"program": "song", "song": song})
 		log.Debug("New")
 
 		ctx, cancel := context.WithCancel(ctx)
@@ -49,12 +49,11 @@ func New(song string, length time.Duration) program.ProgramFactory {
 
 			in:     make(chan program.Coord, program.ChannelBuffer),
 			eq:     make(chan equalizer.DisplayData, program.ChannelBuffer),
-			play:   make(chan string, program.ChannelBuffer),
 			render: make(chan leds.State, program.ChannelBuffer),
 			yield:  make(chan struct{}, program.ChannelBuffer),
 
 			song:   song,
-			length: length,
+			tracks: tracks,
 
 			log: log,
 		}
@@ -73,7 +72,6 @@ func (s *songProgram) Name() string {
 func (s *songProgram) Close() {
 	s.cancel()
 	s.wg.Wait()
-	close(s.play)
 	close(s.render)
 }
 
@@ -109,11 +107,11 @@ func (s *songProgram) EQ(displayData equalizer.DisplayData) {
 	}
 }
 
-func (s *songProgram) Play() <-chan string {
+func (s *songProgram) Play() <-chan program.Sound {
 	return nil
 }
 func (s *songProgram) PlayWithEQ() <-chan string {
-	return s.play
+	return nil
 }
 func (s *songProgram) Render() <-chan leds.State {
 	return s.render
@@ -125,30 +123,39 @@ func (s *songProgram) Yield() <-chan struct{} {
 func (s *songProgram) run() {
 	defer s.wg.Done()
 
-	bands := initBands()
-
-	colorPos := 0
-	colorTicks := 0
+	visualizer := NewVisualizer()
 
-	s.play <- s.song
+	track, err := s.tracks.PlayTrack(s.song)
+	if err != nil {
+		s.log.Errorf("play failed: %v", err)
+		s.yield <- struct{}{}
+		return
+	}
+	defer track.Close()
+	s.log.Debugf("Playing %s", track.Duration())
 
 	presses := 0
 
-	// song duration
-	timer := time.NewTimer(s.length)
-
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 
-		case <-timer.C:
-			s.log.Debug("Timer expired, stopping program")
+		case <-track.Done():
+			s.log.Debug("Song finished, stopping program")
 			s.yield <- struct{}{}
 			return
 
 		case press := <-s.in:
 			s.log.Debugf("Processing press: %+v", press)
+
+			if press.Row == scrubRow && track.Duration() > 0 {
+				position := track.Duration() * time.Duration(press.Col) / program.Cols
+				s.log.Debugf("Seeking from %s to %s", track.Position(), position)
+				track.Seek(position)
+				continue
+			}
+
 			presses++
 
 			if presses >= pressThreshold {
@@ -159,72 +166,7 @@ func (s *songProgram) run() {
 		case displayData := <-s.eq:
 			s.log.Tracef("Processing EQ: %+v", displayData)
 
-			colors := equalizer.Colorize(displayData)
-
-			s.log.Tracef("Rendering colors: %+v", colors)
-
-			ledsState := leds.State{}
-
-			for row, eqColors := range colors {
-				rotatedRow := (row + colorPos) % equalizer.HistorySize
-
-				s.log.Tracef("eqColors[%d]: %+v", rotatedRow, eqColors)
-				for i, pixel := range rows.FlatRows[rotatedRow].Pixels {
-					color := eqColors[bands[rotatedRow][i]]
-					ledsState.Set(pixel.Strip, pixel.Pixel, color)
-				}
-			}
-
-			s.render <- ledsState
-
-			colorTicks++
-			if colorTicks == ticksPerColorRotation {
-				colorPos = (colorPos - 1 + equalizer.HistorySize) % equalizer.HistorySize // Cycle through colors
-				colorTicks = 0
-			}
+			s.render <- visualizer.Render(displayData)
 		}
 	}
 }
-
-// initBands maps each pixel to its closest button.
-func initBands() [program.Rows][]int {
-	button := 0
-
-	bands := [program.Rows][]int{}
-
-	for row := range program.Rows {
-		bands[row] = make([]int, len(rows.FlatRows[row].Pixels))
-
-		for i := range rows.FlatRows[row].Pixels {
-			// figure out which button we are closest to
-			prevButtonIndex := rows.FlatRows[row].Buttons[(button-1+program.Cols)%program.Cols]
-			nextButtonIndex := rows.FlatRows[row].Buttons[button]
-
-			distanceToPrev := i - prevButtonIndex
-			if distanceToPrev < 0 {
-				distanceToPrev = len(rows.FlatRows[row].Pixels) - prevButtonIndex + i
-			}
-			distanceToNext := nextButtonIndex - i
-			if distanceToNext < 0 {
-				distanceToNext = len(rows.FlatRows[row].Pixels) - i + nextButtonIndex
-			}
-
-			if distanceToPrev < 0 || distanceToNext < 0 {
-				log.Errorf("Bad distances: row %d button %d i: %d prev: %d next: %d distToPrev: %d distToNext: %d",
-					row, button, i, prevButtonIndex, nextButtonIndex, distanceToPrev, distanceToNext)
-			}
-
-			bands[row][i] = button
-
-			if distanceToPrev < distanceToNext {
-				bands[row][i] = (button - 1 + program.Cols) % program.Cols
-			}
-
-			if distanceToNext == 0 {
-				button = (button + 1) % program.Cols
-			}
-		}
-	}
-
-	return bands
-}
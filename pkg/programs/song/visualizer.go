@@ -0,0 +1,99 @@
+package song
+
+import (
+	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/rows"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Visualizer renders equalizer data across the rows, one band per button.
+	// It is shared by programs that play songs.
+	Visualizer struct {
+		bands [program.Rows][]int
+
+		colorPos   int
+		colorTicks int
+	}
+)
+
+const (
+	// practically disable color rotation
+	ticksPerColorRotation = 10000000 // 60
+)
+
+func NewVisualizer() *Visualizer {
+	return &Visualizer{bands: initBands()}
+}
+
+// Render returns the LEDs for displayData.
+func (v *Visualizer) Render(displayData equalizer.DisplayData) leds.State {
+	colors := equalizer.Colorize(displayData)
+
+	log.Tracef("Rendering colors: %+v", colors)
+
+	ledsState := leds.State{}
+
+	for row, eqColors := range colors {
+		rotatedRow := (row + v.colorPos) % equalizer.HistorySize
+
+		log.Tracef("eqColors[%d]: %+v", rotatedRow, eqColors)
+		for i, pixel := range rows.FlatRows[rotatedRow].Pixels {
+			color := eqColors[v.bands[rotatedRow][i]]
+			ledsState.Set(pixel.Strip, pixel.Pixel, color)
+		}
+	}
+
+	v.colorTicks++
+	if v.colorTicks == ticksPerColorRotation {
+		v.colorPos = (v.colorPos - 1 + equalizer.HistorySize) % equalizer.HistorySize // Cycle through colors
+		v.colorTicks = 0
+	}
+
+	return ledsState
+}
+
+// initBands maps each pixel to its closest button.
+func initBands() [program.Rows][]int {
+	button := 0
+
+	bands := [program.Rows][]int{}
+
+	for row := range program.Rows {
+		bands[row] = make([]int, len(rows.FlatRows[row].Pixels))
+
+		for i := range rows.FlatRows[row].Pixels {
+			// figure out which button we are closest to
+			prevButtonIndex := rows.FlatRows[row].Buttons[(button-1+program.Cols)%program.Cols]
+			nextButtonIndex := rows.FlatRows[row].Buttons[button]
+
+			distanceToPrev := i - prevButtonIndex
+			if distanceToPrev < 0 {
+				distanceToPrev = len(rows.FlatRows[row].Pixels) - prevButtonIndex + i
+			}
+			distanceToNext := nextButtonIndex - i
+			if distanceToNext < 0 {
+				distanceToNext = len(rows.FlatRows[row].Pixels) - i + nextButtonIndex
+			}
+
+			if distanceToPrev < 0 || distanceToNext < 0 {
+				log.Errorf("Bad distances: row %d button %d i: %d prev: %d next: %d distToPrev: %d distToNext: %d",
+					row, button, i, prevButtonIndex, nextButtonIndex, distanceToPrev, distanceToNext)
+			}
+
+			bands[row][i] = button
+
+			if distanceToPrev < distanceToNext {
+				bands[row][i] = (button - 1 + program.Cols) % program.Cols
+			}
+
+			if distanceToNext == 0 {
+				button = (button + 1) % program.Cols
+			}
+		}
+	}
+
+	return bands
+}
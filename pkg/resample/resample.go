@@ -0,0 +1,190 @@
+// Package resample converts audio between sample rates with a windowed sinc
+// filter.
+package resample
+
+import "math"
+
+type (
+	// Resampler converts from one sample rate to another. The filter is built
+	// once, so reuse a Resampler for many buffers at the same rates.
+	Resampler struct {
+		// output sample n reads input around n*down/up
+		up   int
+		down int
+
+		// halfTaps input samples are read on each side of the output sample
+		halfTaps int
+		// phases[p] holds the filter for output samples p/up past an input
+		// sample, nil if there are too many phases to precompute
+		phases [][]float32
+		cutoff float64
+	}
+
+	// Stream is a Resampler applied to a stream, see Resampler.Stream.
+	Stream struct {
+		r *Resampler
+
+		// in holds the input still needed, in[0] is input sample base
+		in    []float32
+		base  int64
+		total int64
+		// next is the next output sample
+		next int64
+	}
+)
+
+const (
+	// zeroCrossings of the sinc on each side, higher is sharper and slower
+	zeroCrossings = 16
+
+	// maxPhases bounds the precomputed filter table, unusual rate pairs
+	// compute the filter for each output sample instead
+	maxPhases = 1024
+)
+
+// New returns a Resampler from rate from to rate to, in Hz.
+func New(from, to int) *Resampler {
+	g := gcd(from, to)
+	r := &Resampler{
+		up:     to / g,
+		down:   from / g,
+		cutoff: math.Min(1, float64(to)/float64(from)),
+	}
+
+	// when downsampling, widen the filter to cut off below the new Nyquist
+	r.halfTaps = int(math.Ceil(zeroCrossings / r.cutoff))
+
+	if r.up <= maxPhases {
+		r.phases = make([][]float32, r.up)
+		for p := range r.phases {
+			r.phases[p] = r.filter(float64(p) / float64(r.up))
+		}
+	}
+
+	return r
+}
+
+// Resample converts samples from rate from to rate to, in Hz.
+func Resample(samples []float32, from, to int) []float32 {
+	if from == to {
+		return samples
+	}
+	return New(from, to).Resample(samples)
+}
+
+// Resample converts a whole buffer. Samples past either end are treated as
+// silence.
+func (r *Resampler) Resample(samples []float32) []float32 {
+	if r.up == r.down {
+		return samples
+	}
+
+	n := int(int64(len(samples)) * int64(r.up) / int64(r.down))
+	out := make([]float32, n)
+	for i := range out {
+		out[i] = r.sample(samples, 0, int64(i))
+	}
+
+	return out
+}
+
+// Stream resamples a stream chunk by chunk. It keeps the end of each chunk to
+// filter across the boundary with the next one.
+func (r *Resampler) Stream() *Stream {
+	return &Stream{r: r}
+}
+
+// Process takes the next chunk of input, and returns the output it completes.
+// Pass final with the last chunk to flush the rest of the output.
+func (s *Stream) Process(in []float32, final bool) []float32 {
+	r := s.r
+	if r.up == r.down {
+		return append([]float32(nil), in...)
+	}
+
+	s.in = append(s.in, in...)
+	s.total += int64(len(in))
+
+	// output samples whose filter reaches past the input so far wait for
+	// the next chunk, unless this is the last one
+	end := ((s.total-int64(r.halfTaps))*int64(r.up) + int64(r.down) - 1) / int64(r.down)
+	if final {
+		end = s.total * int64(r.up) / int64(r.down)
+	}
+
+	var out []float32
+	for ; s.next < end; s.next++ {
+		out = append(out, r.sample(s.in, s.base, s.next))
+	}
+
+	// drop input no longer needed by the next output sample
+	if drop := s.next*int64(r.down)/int64(r.up) - int64(r.halfTaps) + 1 - s.base; drop > 0 {
+		drop = min(drop, int64(len(s.in)))
+		s.in = s.in[drop:]
+		s.base += drop
+	}
+
+	return out
+}
+
+// sample returns output sample i, from input samples where samples[0] is input
+// sample base.
+func (r *Resampler) sample(samples []float32, base int64, i int64) float32 {
+	pos := i * int64(r.down)
+	center := pos / int64(r.up)
+	phase := int(pos % int64(r.up))
+
+	var filter []float32
+	if r.phases != nil {
+		filter = r.phases[phase]
+	} else {
+		filter = r.filter(float64(phase) / float64(r.up))
+	}
+
+	// filter[k] weighs the input sample at center-halfTaps+1+k
+	start := int(center-base) - r.halfTaps + 1
+	var sum float32
+	for k, weight := range filter {
+		j := start + k
+		if j < 0 || j >= len(samples) {
+			continue
+		}
+		sum += samples[j] * weight
+	}
+	return sum
+}
+
+// filter returns the weights of the 2*halfTaps input samples around an output
+// sample frac of the way from one input sample to the next.
+func (r *Resampler) filter(frac float64) []float32 {
+	filter := make([]float32, 2*r.halfTaps)
+	for k := range filter {
+		// distance from the output sample, in input samples
+		x := float64(k-r.halfTaps+1) - frac
+		filter[k] = float32(r.cutoff * sinc(r.cutoff*x) * blackman(x/float64(r.halfTaps)))
+	}
+	return filter
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is the Blackman window over -1 <= x <= 1.
+func blackman(x float64) float64 {
+	if x <= -1 || x >= 1 {
+		return 0
+	}
+	t := math.Pi * (x + 1)
+	return 0.42 - 0.5*math.Cos(t) + 0.08*math.Cos(2*t)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
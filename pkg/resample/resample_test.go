@@ -0,0 +1,126 @@
+package resample
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// rates covers downsampling, upsampling, and a pair with too many phases to
+// precompute
+var rates = []struct {
+	from int
+	to   int
+}{
+	{48000, 44100},
+	{44100, 48000},
+	{22050, 44100},
+	{44100, 44099},
+}
+
+func TestResampleLength(t *testing.T) {
+	testCases := []struct {
+		from int
+		to   int
+		in   int
+		want int
+	}{
+		{48000, 44100, 48000, 44100},
+		{48000, 44100, 480, 441},
+		// partial output samples are dropped
+		{48000, 44100, 100, 91},
+		{44100, 48000, 44100, 48000},
+		{22050, 44100, 1000, 2000},
+		{44100, 44100, 1000, 1000},
+		{48000, 44100, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d samples %d to %d", tc.in, tc.from, tc.to), func(t *testing.T) {
+			if got := len(Resample(make([]float32, tc.in), tc.from, tc.to)); got != tc.want {
+				t.Errorf("%d samples, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResampleDC(t *testing.T) {
+	for _, rate := range rates {
+		t.Run(fmt.Sprintf("%d to %d", rate.from, rate.to), func(t *testing.T) {
+			in := make([]float32, rate.from/10)
+			for i := range in {
+				in[i] = 0.5
+			}
+
+			out := Resample(in, rate.from, rate.to)
+			for i, sample := range middle(out) {
+				if math.Abs(float64(sample)-0.5) > 1e-3 {
+					t.Fatalf("sample %d is %v, want 0.5", i, sample)
+				}
+			}
+		})
+	}
+}
+
+func TestResampleSine(t *testing.T) {
+	const freq = 1000
+
+	for _, rate := range rates {
+		t.Run(fmt.Sprintf("%d to %d", rate.from, rate.to), func(t *testing.T) {
+			out := Resample(sine(freq, rate.from, rate.from/10), rate.from, rate.to)
+
+			// output sample i is at i/to seconds, so it matches the same sine
+			// sampled at the new rate
+			want := sine(freq, rate.to, len(out))
+			mid := middle(out)
+			offset := (len(out) - len(mid)) / 2
+			for i, sample := range mid {
+				if math.Abs(float64(sample-want[offset+i])) > 1e-3 {
+					t.Fatalf("sample %d is %v, want %v", offset+i, sample, want[offset+i])
+				}
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	for _, rate := range rates {
+		in := sine(1000, rate.from, 5000)
+		want := Resample(in, rate.from, rate.to)
+
+		for _, chunk := range []int{1, 7, 1000, len(in)} {
+			t.Run(fmt.Sprintf("%d to %d in chunks of %d", rate.from, rate.to, chunk), func(t *testing.T) {
+				s := New(rate.from, rate.to).Stream()
+
+				var out []float32
+				for i := 0; i < len(in); i += chunk {
+					end := min(i+chunk, len(in))
+					out = append(out, s.Process(in[i:end], end == len(in))...)
+				}
+
+				if len(out) != len(want) {
+					t.Fatalf("streamed %d samples, want %d", len(out), len(want))
+				}
+				for i := range out {
+					if out[i] != want[i] {
+						t.Fatalf("sample %d is %v, want %v", i, out[i], want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func sine(freq, rate, n int) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(0.5 * math.Sin(2*math.Pi*float64(freq*i)/float64(rate)))
+	}
+	return samples
+}
+
+// middle drops the ends of samples, where the filter reaches past the input.
+func middle(samples []float32) []float32 {
+	edge := len(samples) / 10
+	return samples[edge : len(samples)-edge]
+}
@@ -0,0 +1,37 @@
+package rows
+
+// Ring describes a physically contiguous loop of pixels, for display purposes.
+type Ring struct {
+	Pixels []Coord
+	// Buttons are indices into Pixels, may be empty
+	Buttons []int
+}
+
+// Layout describes how a set of strips should be drawn by a simulator.
+type Layout []Ring
+
+// BeatboxerLayout draws each beat row as a ring, in button order.
+func BeatboxerLayout() Layout {
+	layout := make(Layout, len(FlatRows))
+	for i, row := range FlatRows {
+		layout[i] = Ring{
+			Pixels:  row.Pixels,
+			Buttons: row.Buttons[:],
+		}
+	}
+
+	return layout
+}
+
+// StripLayout draws each strip as its own ring.
+func StripLayout(stripLengths []int) Layout {
+	layout := make(Layout, len(stripLengths))
+	for strip, length := range stripLengths {
+		layout[strip].Pixels = make([]Coord, length)
+		for pixel := range length {
+			layout[strip].Pixels[pixel] = Coord{Strip: strip, Pixel: pixel}
+		}
+	}
+
+	return layout
+}
@@ -0,0 +1,442 @@
+// Package scheduler runs one program at a time from a roster, and switches
+// between them: when the current program yields, when a device presses the
+// yield key enough times, when a rolling code unlocks a program, on command,
+// or after a while without presses.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/input"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Entry is a program in the roster.
+	Entry struct {
+		Name string
+		New  program.ProgramFactory
+		// Code is a rolling code on row 0 that unlocks the program
+		Code []int
+		// Hidden programs are skipped when moving to the next program, and
+		// only reachable by Code or Switch
+		Hidden bool
+	}
+
+	// State is the scheduler's lifecycle state.
+	State int
+
+	// Reason is why the scheduler switched programs.
+	Reason int
+
+	// Event is a program switch.
+	Event struct {
+		// From is the name of the previous program, empty on start
+		From   string
+		To     string
+		Reason Reason
+		At     time.Time
+	}
+
+	// Hook is called with a program as it starts or stops.
+	Hook func(p program.Program, reason Reason)
+
+	// Option configures optional Scheduler behavior.
+	Option func(*Scheduler)
+
+	// Scheduler is not safe for concurrent use, it is driven from one loop
+	// that also reads the current program's channels.
+	Scheduler struct {
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		entries []Entry
+		// pending entries are swapped in at the next switch
+		pending []Entry
+
+		state   State
+		cur     int
+		name    string
+		current program.Program
+		// cancelCurrent cancels the running program's context
+		cancelCurrent context.CancelFunc
+
+		yieldCounts  map[input.Device]int
+		rollingCodes map[input.Device][]int
+
+		transition     Transition
+		transitionTime time.Duration
+		// frame is the current program's LEDs, kept to blend from at the next
+		// switch
+		frame     leds.State
+		crossfade *crossfade
+
+		clock       clock.Clock
+		idleTimeout time.Duration
+		idle        clock.Timer
+		onEnter     Hook
+		onExit      Hook
+		events      chan Event
+
+		log *log.Entry
+	}
+)
+
+const (
+	StateIdle State = iota
+	StateRunning
+	StateClosed
+)
+
+const (
+	ReasonStart Reason = iota
+	// ReasonUserYield is a device pressing the yield key yieldLimit times
+	ReasonUserYield
+	// ReasonProgramYield is the program yielding on its own
+	ReasonProgramYield
+	// ReasonCode is a rolling code unlocking a program
+	ReasonCode
+	// ReasonCommand is Next or Switch called directly, e.g. over OSC
+	ReasonCommand
+	// ReasonTimeout is no presses for the idle timeout
+	ReasonTimeout
+)
+
+const (
+	// yieldLimit is the number of presses of yieldKey in a row that switch
+	// to the next program
+	yieldLimit = 5
+	codeLength = 4
+	codeRow    = 0
+)
+
+var yieldKey = program.Coord{Row: program.Rows - 1, Col: program.Cols - 1}
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRunning:
+		return "running"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonStart:
+		return "start"
+	case ReasonUserYield:
+		return "user yield"
+	case ReasonProgramYield:
+		return "program yield"
+	case ReasonCode:
+		return "code"
+	case ReasonCommand:
+		return "command"
+	case ReasonTimeout:
+		return "timeout"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+// OnEnter calls hook after each program starts.
+func OnEnter(hook Hook) Option {
+	return func(s *Scheduler) {
+		s.onEnter = hook
+	}
+}
+
+// OnExit calls hook after each program closes, before the next one starts.
+// With a transition, it is called as the program stops taking presses, and the
+// program closes once the transition ends.
+func OnExit(hook Hook) Option {
+	return func(s *Scheduler) {
+		s.onExit = hook
+	}
+}
+
+// WithIdleTimeout moves to the next program after d without presses, see
+// Idle.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.idleTimeout = d
+	}
+}
+
+// WithClock times the idle timeout and events on c instead of the system
+// clock.
+func WithClock(c clock.Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// New returns a Scheduler for entries, see Start. Programs run in contexts
+// derived from ctx.
+func New(ctx context.Context, entries []Entry, opts ...Option) (*Scheduler, error) {
+	if err := check(entries); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Scheduler{
+		ctx:    ctx,
+		cancel: cancel,
+
+		entries: entries,
+
+		yieldCounts:  map[input.Device]int{},
+		rollingCodes: map[input.Device][]int{},
+
+		clock:  clock.Real,
+		events: make(chan Event, program.ChannelBuffer),
+
+		log: log.WithField("bbox", "scheduler"),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// Start starts the first program.
+func (s *Scheduler) Start() {
+	if s.state != StateIdle {
+		return
+	}
+
+	if s.idleTimeout > 0 {
+		s.idle = s.clock.NewTimer(s.idleTimeout)
+	}
+
+	s.start(s.entries[s.cur].New, s.entries[s.cur].Name, ReasonStart)
+}
+
+// Current returns the running program, nil before Start.
+func (s *Scheduler) Current() program.Program {
+	return s.current
+}
+
+// Name returns the running program's name in the roster.
+func (s *Scheduler) Name() string {
+	return s.name
+}
+
+func (s *Scheduler) State() State {
+	return s.state
+}
+
+// Events receives every program switch, dropped if not read in time.
+func (s *Scheduler) Events() <-chan Event {
+	return s.events
+}
+
+// Idle fires when no press has arrived for the idle timeout, call Next with
+// ReasonTimeout. It is nil without WithIdleTimeout.
+func (s *Scheduler) Idle() <-chan time.Time {
+	if s.idle == nil {
+		return nil
+	}
+	return s.idle.C()
+}
+
+// SetEntries replaces the roster at the next switch.
+func (s *Scheduler) SetEntries(entries []Entry) error {
+	if err := check(entries); err != nil {
+		return err
+	}
+
+	s.pending = entries
+	return nil
+}
+
+// Press switches programs on the yield key or a rolling code, and otherwise
+// passes the press to the running program. Each device counts yield presses
+// and rolling codes on its own, so presses on one don't interrupt a sequence
+// on another.
+func (s *Scheduler) Press(press input.Press) {
+	if s.state != StateRunning {
+		return
+	}
+
+	s.resetIdle()
+
+	if press.Coord == yieldKey {
+		s.yieldCounts[press.Device]++
+		s.log.Debugf("yieldCount: %d", s.yieldCounts[press.Device])
+		if s.yieldCounts[press.Device] >= yieldLimit {
+			s.Next(ReasonUserYield)
+			return
+		}
+	} else {
+		s.yieldCounts[press.Device] = 0
+	}
+
+	if press.Row == codeRow {
+		rollingCode, ok := s.rollingCodes[press.Device]
+		if !ok {
+			rollingCode = make([]int, codeLength)
+		}
+		rollingCode = append(rollingCode[1:], press.Col)
+		s.rollingCodes[press.Device] = rollingCode
+
+		if i := slices.IndexFunc(s.entries, func(e Entry) bool {
+			return slices.Equal(e.Code, rollingCode)
+		}); i >= 0 {
+			s.log.Debugf("rolling code matched: %v", rollingCode)
+			s.yield(s.entries[i].New, s.entries[i].Name, ReasonCode)
+		}
+	} else {
+		delete(s.rollingCodes, press.Device)
+	}
+
+	s.current.Press(press.Coord)
+}
+
+// Next closes the running program, and starts the next program in the roster
+// that isn't hidden.
+func (s *Scheduler) Next(reason Reason) {
+	if s.state != StateRunning {
+		return
+	}
+
+	s.yield(nil, "", reason)
+}
+
+// Switch closes the running program, and starts the named one. Like a rolling
+// code, when it yields the roster continues from where it was.
+func (s *Scheduler) Switch(name string, reason Reason) error {
+	if s.state != StateRunning {
+		return fmt.Errorf("cannot switch while %s", s.state)
+	}
+
+	i := slices.IndexFunc(s.entries, func(e Entry) bool {
+		return e.Name == name
+	})
+	if i < 0 {
+		return fmt.Errorf("no program named %q", name)
+	}
+
+	s.yield(s.entries[i].New, s.entries[i].Name, reason)
+	return nil
+}
+
+// Close closes the running program, and the outgoing one if transitioning.
+func (s *Scheduler) Close() {
+	if s.state == StateClosed {
+		return
+	}
+
+	s.cancel()
+	s.finish()
+	if s.current != nil {
+		s.cancelCurrent()
+		s.current.Close()
+	}
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+
+	s.state = StateClosed
+}
+
+// yield closes the running program and starts next, or the next program in
+// the roster if nil.
+func (s *Scheduler) yield(next program.ProgramFactory, name string, reason Reason) {
+	s.log.Debugf("yield prev program: %s (%s)", s.name, reason)
+
+	if s.transitions() {
+		s.fadeOutCurrent()
+	} else {
+		s.cancelCurrent()
+		s.current.Close()
+	}
+	if s.onExit != nil {
+		s.onExit(s.current, reason)
+	}
+
+	if s.pending != nil {
+		s.log.Infof("swapping in %d reloaded programs", len(s.pending))
+		// keep our place in the roster by name, or start over if it was
+		// removed
+		name := s.entries[s.cur].Name
+		s.entries = s.pending
+		s.pending = nil
+		s.cur = max(0, slices.IndexFunc(s.entries, func(e Entry) bool { return e.Name == name }))
+	}
+
+	if next == nil {
+		for {
+			s.cur = (s.cur + 1) % len(s.entries)
+			if !s.entries[s.cur].Hidden {
+				break
+			}
+		}
+
+		next = s.entries[s.cur].New
+		name = s.entries[s.cur].Name
+	} else {
+		// back cur up one so we yield back to the same place
+		s.cur = (s.cur - 1 + len(s.entries)) % len(s.entries)
+	}
+
+	s.start(next, name, reason)
+}
+
+func (s *Scheduler) start(next program.ProgramFactory, name string, reason Reason) {
+	from := s.name
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.current = next(ctx)
+	s.cancelCurrent = cancel
+	s.name = name
+	s.frame = leds.State{}
+	clear(s.yieldCounts)
+	s.resetIdle()
+	s.state = StateRunning
+
+	if s.onEnter != nil {
+		s.onEnter(s.current, reason)
+	}
+
+	s.log.Debugf("yield new program: %s", name)
+
+	select {
+	case s.events <- Event{From: from, To: name, Reason: reason, At: s.clock.Now()}:
+	default:
+	}
+}
+
+func (s *Scheduler) resetIdle() {
+	if s.idle == nil {
+		return
+	}
+
+	if !s.idle.Stop() {
+		select {
+		case <-s.idle.C():
+		default:
+		}
+	}
+	s.idle.Reset(s.idleTimeout)
+}
+
+func check(entries []Entry) error {
+	if !slices.ContainsFunc(entries, func(e Entry) bool { return !e.Hidden }) {
+		return errors.New("no programs that aren't hidden")
+	}
+	return nil
+}
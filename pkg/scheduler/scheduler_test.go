@@ -0,0 +1,377 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/input"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+)
+
+type stub struct {
+	name    string
+	presses []program.Coord
+	closed  bool
+	render  chan leds.State
+}
+
+var (
+	keyboard = input.Device{Kind: input.KindKeyboard, Name: "keyboard"}
+	web      = input.Device{Kind: input.KindWeb, Name: ":8080"}
+)
+
+func TestScheduler(t *testing.T) {
+	roster := []Entry{
+		entry("a"),
+		entry("b"),
+		{Name: "secret", New: factory("secret"), Code: []int{1, 2, 3, 4}, Hidden: true},
+	}
+
+	testCases := []struct {
+		name    string
+		run     func(t *testing.T, s *Scheduler)
+		want    string
+		reasons []Reason
+	}{
+		{
+			name: "start",
+			want: "a",
+		},
+		{
+			name: "yield key",
+			run: func(t *testing.T, s *Scheduler) {
+				presses(s, keyboard, yieldKey, yieldLimit)
+			},
+			want:    "b",
+			reasons: []Reason{ReasonUserYield},
+		},
+		{
+			name: "yield key counted per device",
+			run: func(t *testing.T, s *Scheduler) {
+				presses(s, keyboard, yieldKey, yieldLimit-1)
+				presses(s, web, yieldKey, yieldLimit-1)
+			},
+			want: "a",
+		},
+		{
+			name: "yield key not interrupted by another device",
+			run: func(t *testing.T, s *Scheduler) {
+				presses(s, keyboard, yieldKey, yieldLimit-1)
+				presses(s, web, program.Coord{Row: 1, Col: 1}, 1)
+				presses(s, keyboard, yieldKey, 1)
+			},
+			want:    "b",
+			reasons: []Reason{ReasonUserYield},
+		},
+		{
+			name: "yield key reset by another key",
+			run: func(t *testing.T, s *Scheduler) {
+				presses(s, keyboard, yieldKey, yieldLimit-1)
+				presses(s, keyboard, program.Coord{Row: 1, Col: 1}, 1)
+				presses(s, keyboard, yieldKey, 1)
+			},
+			want: "a",
+		},
+		{
+			name: "next skips hidden programs",
+			run: func(t *testing.T, s *Scheduler) {
+				s.Next(ReasonCommand)
+				s.Next(ReasonCommand)
+			},
+			want:    "a",
+			reasons: []Reason{ReasonCommand, ReasonCommand},
+		},
+		{
+			name: "rolling code",
+			run: func(t *testing.T, s *Scheduler) {
+				code(s, keyboard, 1, 2, 3, 4)
+			},
+			want:    "secret",
+			reasons: []Reason{ReasonCode},
+		},
+		{
+			name: "rolling code counted per device",
+			run: func(t *testing.T, s *Scheduler) {
+				code(s, keyboard, 1, 2)
+				code(s, web, 3, 4)
+				if s.Name() != "a" {
+					t.Fatalf("code across devices switched to %s", s.Name())
+				}
+				code(s, keyboard, 3, 4)
+			},
+			want:    "secret",
+			reasons: []Reason{ReasonCode},
+		},
+		{
+			name: "rolling code reset off row 0",
+			run: func(t *testing.T, s *Scheduler) {
+				code(s, keyboard, 1, 2)
+				presses(s, keyboard, program.Coord{Row: 1, Col: 3}, 1)
+				code(s, keyboard, 3, 4)
+			},
+			want: "a",
+		},
+		{
+			name: "yield after a rolling code returns to where it was",
+			run: func(t *testing.T, s *Scheduler) {
+				s.Next(ReasonCommand)
+				code(s, keyboard, 1, 2, 3, 4)
+				s.Next(ReasonProgramYield)
+			},
+			want:    "b",
+			reasons: []Reason{ReasonCommand, ReasonCode, ReasonProgramYield},
+		},
+		{
+			name: "switch",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.Switch("secret", ReasonCommand); err != nil {
+					t.Fatalf("Switch failed: %v", err)
+				}
+			},
+			want:    "secret",
+			reasons: []Reason{ReasonCommand},
+		},
+		{
+			name: "switch to an unknown program",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.Switch("nope", ReasonCommand); err == nil {
+					t.Fatal("Switch succeeded, want an error")
+				}
+			},
+			want: "a",
+		},
+		{
+			name: "entries applied at the next switch",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.SetEntries([]Entry{entry("x"), entry("y"), entry("z")}); err != nil {
+					t.Fatalf("SetEntries failed: %v", err)
+				}
+				if s.Name() != "a" {
+					t.Fatalf("SetEntries switched to %s", s.Name())
+				}
+				s.Next(ReasonCommand)
+			},
+			want:    "y",
+			reasons: []Reason{ReasonCommand},
+		},
+		{
+			name: "entries keep the current program's place",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.SetEntries([]Entry{entry("x"), entry("a"), entry("y"), entry("b")}); err != nil {
+					t.Fatalf("SetEntries failed: %v", err)
+				}
+				s.Next(ReasonCommand)
+			},
+			want:    "y",
+			reasons: []Reason{ReasonCommand},
+		},
+		{
+			name: "entries reordered past the current program",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.SetEntries([]Entry{entry("b"), entry("x"), entry("a")}); err != nil {
+					t.Fatalf("SetEntries failed: %v", err)
+				}
+				s.Next(ReasonCommand)
+			},
+			want:    "b",
+			reasons: []Reason{ReasonCommand},
+		},
+		{
+			name: "entries that are all hidden are rejected",
+			run: func(t *testing.T, s *Scheduler) {
+				if err := s.SetEntries([]Entry{{Name: "x", New: factory("x"), Hidden: true}}); err == nil {
+					t.Fatal("SetEntries succeeded, want an error")
+				}
+				s.Next(ReasonCommand)
+			},
+			want:    "b",
+			reasons: []Reason{ReasonCommand},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(context.Background(), roster, WithClock(clock.NewFake(time.Unix(0, 0))))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer s.Close()
+
+			s.Start()
+			first := s.Current()
+			if tc.run != nil {
+				tc.run(t, s)
+			}
+
+			if s.Name() != tc.want {
+				t.Errorf("running %s, want %s", s.Name(), tc.want)
+			}
+			if got := s.Current().Name(); got != tc.want {
+				t.Errorf("current program is %s, want %s", got, tc.want)
+			}
+			if switched := len(tc.reasons) > 0; first.(*stub).closed != switched {
+				t.Errorf("first program closed: %t, want %t", first.(*stub).closed, switched)
+			}
+
+			want := append([]Reason{ReasonStart}, tc.reasons...)
+			if got := reasons(s); !slices.Equal(got, want) {
+				t.Errorf("switched for %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPressesPassedOn(t *testing.T) {
+	s, err := New(context.Background(), []Entry{entry("a"), entry("b")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	s.Start()
+	first := s.Current().(*stub)
+
+	presses(s, keyboard, program.Coord{Row: 2, Col: 3}, 2)
+	presses(s, keyboard, yieldKey, yieldLimit)
+	presses(s, keyboard, program.Coord{Row: 1, Col: 1}, 1)
+
+	// the press that yields goes to neither program
+	want := []program.Coord{{Row: 2, Col: 3}, {Row: 2, Col: 3}}
+	want = append(want, slices.Repeat([]program.Coord{yieldKey}, yieldLimit-1)...)
+	if !slices.Equal(first.presses, want) {
+		t.Errorf("first program got %v, want %v", first.presses, want)
+	}
+
+	next := s.Current().(*stub)
+	if want := []program.Coord{{Row: 1, Col: 1}}; !slices.Equal(next.presses, want) {
+		t.Errorf("next program got %v, want %v", next.presses, want)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	s, err := New(context.Background(), []Entry{entry("a"), entry("b")},
+		WithClock(fake),
+		WithIdleTimeout(time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	s.Start()
+
+	fake.Advance(59 * time.Second)
+	if idle(s) {
+		t.Fatal("idle before the timeout")
+	}
+
+	// a press restarts the timeout
+	presses(s, keyboard, program.Coord{Row: 1, Col: 1}, 1)
+	fake.Advance(59 * time.Second)
+	if idle(s) {
+		t.Fatal("idle before the timeout since the last press")
+	}
+
+	fake.Advance(time.Second)
+	if !idle(s) {
+		t.Fatal("not idle after the timeout")
+	}
+
+	s.Next(ReasonTimeout)
+	if s.Name() != "b" {
+		t.Errorf("running %s, want b", s.Name())
+	}
+
+	// the next program gets a full timeout
+	fake.Advance(59 * time.Second)
+	if idle(s) {
+		t.Fatal("idle before the next program's timeout")
+	}
+	fake.Advance(time.Second)
+	if !idle(s) {
+		t.Fatal("next program not idle after the timeout")
+	}
+
+	if got, want := reasons(s), []Reason{ReasonStart, ReasonTimeout}; !slices.Equal(got, want) {
+		t.Errorf("switched for %v, want %v", got, want)
+	}
+}
+
+func TestNoIdleTimeout(t *testing.T) {
+	s, err := New(context.Background(), []Entry{entry("a")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	s.Start()
+	if s.Idle() != nil {
+		t.Error("Idle is not nil without WithIdleTimeout")
+	}
+}
+
+func TestNoVisiblePrograms(t *testing.T) {
+	if _, err := New(context.Background(), []Entry{{Name: "x", New: factory("x"), Hidden: true}}); err == nil {
+		t.Error("New succeeded, want an error")
+	}
+}
+
+func entry(name string) Entry {
+	return Entry{Name: name, New: factory(name)}
+}
+
+func factory(name string) program.ProgramFactory {
+	return func(context.Context) program.Program {
+		return &stub{name: name, render: make(chan leds.State, program.ChannelBuffer)}
+	}
+}
+
+func presses(s *Scheduler, device input.Device, coord program.Coord, n int) {
+	for range n {
+		s.Press(input.Press{Coord: coord, Device: device})
+	}
+}
+
+// code presses cols on row 0.
+func code(s *Scheduler, device input.Device, cols ...int) {
+	for _, col := range cols {
+		presses(s, device, program.Coord{Row: codeRow, Col: col}, 1)
+	}
+}
+
+// reasons drains the scheduler's events.
+func reasons(s *Scheduler) []Reason {
+	var reasons []Reason
+	for {
+		select {
+		case event := <-s.Events():
+			reasons = append(reasons, event.Reason)
+		default:
+			return reasons
+		}
+	}
+}
+
+func idle(s *Scheduler) bool {
+	select {
+	case <-s.Idle():
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *stub) Name() string               { return p.name }
+func (p *stub) Press(press program.Coord)  { p.presses = append(p.presses, press) }
+func (p *stub) EQ(equalizer.DisplayData)   {}
+func (p *stub) Play() <-chan program.Sound { return nil }
+func (p *stub) PlayWithEQ() <-chan string  { return nil }
+func (p *stub) Render() <-chan leds.State  { return p.render }
+func (p *stub) Yield() <-chan struct{}     { return nil }
+func (p *stub) Close()                     { p.closed = true }
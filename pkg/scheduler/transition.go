@@ -0,0 +1,279 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/rows"
+)
+
+type (
+	// Transition is how the LEDs move from one program to the next.
+	Transition int
+
+	// crossfade is a transition in progress.
+	crossfade struct {
+		out    program.Program
+		cancel context.CancelFunc
+		// from is the outgoing program's LEDs
+		from  leds.State
+		start time.Time
+		// frames ticks while the transition runs, so it moves on even if
+		// neither program renders
+		frames clock.Ticker
+		// sparkle is when each pixel dissolves, between 0 and 1
+		sparkle map[rows.Coord]float64
+	}
+
+	// none is the Outgoing program when not transitioning, it never renders,
+	// plays or yields.
+	none struct{}
+)
+
+const (
+	// TransitionCut closes the outgoing program, and starts the next one on
+	// black
+	TransitionCut Transition = iota
+	// TransitionFade crossfades every pixel at once
+	TransitionFade
+	// TransitionWipe sweeps the incoming program along each row of buttons
+	TransitionWipe
+	// TransitionSparkle dissolves to the incoming program pixel by pixel, in
+	// random order
+	TransitionSparkle
+)
+
+const (
+	frameInterval = 30 * time.Millisecond
+
+	// edge is the fraction of a wipe or sparkle over which each pixel fades,
+	// rather than switching outright
+	edge = 0.1
+)
+
+// wipePositions is how far along its row of buttons each pixel is, between 0
+// and 1.
+var wipePositions = func() map[rows.Coord]float64 {
+	positions := map[rows.Coord]float64{}
+	for _, row := range rows.FlatRows {
+		for i, pixel := range row.Pixels {
+			positions[pixel] = float64(i) / float64(max(1, len(row.Pixels)-1))
+		}
+	}
+	return positions
+}()
+
+func (t Transition) String() string {
+	switch t {
+	case TransitionCut:
+		return "cut"
+	case TransitionFade:
+		return "fade"
+	case TransitionWipe:
+		return "wipe"
+	case TransitionSparkle:
+		return "sparkle"
+	default:
+		return fmt.Sprintf("Transition(%d)", int(t))
+	}
+}
+
+// ParseTransition returns the transition named name, e.g. fade.
+func ParseTransition(name string) (Transition, error) {
+	for t := TransitionCut; t <= TransitionSparkle; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transition: %s", name)
+}
+
+// WithTransition keeps the outgoing program running for d after each switch,
+// see Outgoing, and blends its LEDs into the incoming program's with t.
+func WithTransition(t Transition, d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.transition = t
+		s.transitionTime = d
+	}
+}
+
+// Outgoing returns the program transitioning out. Read its Render and Play
+// like the current program's until the transition ends, see RenderOutgoing
+// and Progress.
+func (s *Scheduler) Outgoing() program.Program {
+	if s.crossfade == nil {
+		return none{}
+	}
+	return s.crossfade.out
+}
+
+// Progress returns how far through the transition the scheduler is, between
+// 0 and 1, and 1 when not transitioning. Scale the outgoing program's sounds
+// by 1 - Progress.
+func (s *Scheduler) Progress() float64 {
+	if s.crossfade == nil {
+		return 1
+	}
+	return min(1, float64(s.clock.Since(s.crossfade.start))/float64(s.transitionTime))
+}
+
+// Render takes LEDs from the current program, and returns the LEDs to show,
+// blended with the outgoing program's during a transition.
+func (s *Scheduler) Render(state leds.State) leds.State {
+	if !s.transitions() {
+		return state
+	}
+
+	s.frame.Apply(state)
+	if s.crossfade == nil {
+		return state
+	}
+	return s.blend()
+}
+
+// RenderOutgoing takes LEDs from the Outgoing program, and returns the LEDs to
+// show.
+func (s *Scheduler) RenderOutgoing(state leds.State) leds.State {
+	if s.crossfade == nil {
+		return leds.State{}
+	}
+
+	s.crossfade.from.Apply(state)
+	return s.blend()
+}
+
+// Frames ticks during a transition, call Frame on each tick. It is nil when
+// not transitioning.
+func (s *Scheduler) Frames() <-chan time.Time {
+	if s.crossfade == nil {
+		return nil
+	}
+	return s.crossfade.frames.C()
+}
+
+// Frame returns the LEDs to show as the transition moves on, and closes the
+// outgoing program once it is over.
+func (s *Scheduler) Frame() leds.State {
+	if s.crossfade == nil || s.Progress() >= 1 {
+		frame := leds.State{}
+		if s.crossfade != nil {
+			// black out what only the outgoing program lit
+			for strip, pixels := range s.crossfade.from {
+				for pixel := range pixels {
+					frame.Set(strip, pixel, leds.Black)
+				}
+			}
+		}
+		frame.Apply(s.frame)
+
+		s.finish()
+		return frame
+	}
+	return s.blend()
+}
+
+func (s *Scheduler) transitions() bool {
+	return s.transition != TransitionCut && s.transitionTime > 0
+}
+
+// fadeOutCurrent moves the current program out, still running, for the next
+// one to blend with. A transition in progress ends where it got to.
+func (s *Scheduler) fadeOutCurrent() {
+	from := s.frame
+	if s.crossfade != nil {
+		from = s.blend()
+		s.finish()
+	}
+
+	s.crossfade = &crossfade{
+		out:    s.current,
+		cancel: s.cancelCurrent,
+		from:   from,
+		start:  s.clock.Now(),
+		frames: s.clock.NewTicker(frameInterval),
+	}
+	if s.transition == TransitionSparkle {
+		s.crossfade.sparkle = map[rows.Coord]float64{}
+	}
+}
+
+// finish closes the outgoing program, if any.
+func (s *Scheduler) finish() {
+	if s.crossfade == nil {
+		return
+	}
+
+	s.log.Debugf("transition done: %s", s.crossfade.out.Name())
+
+	s.crossfade.frames.Stop()
+	s.crossfade.cancel()
+	s.crossfade.out.Close()
+	s.crossfade = nil
+}
+
+// blend mixes the outgoing and current programs' LEDs, pixels either one
+// hasn't set are black.
+func (s *Scheduler) blend() leds.State {
+	progress := s.Progress()
+
+	frame := leds.State{}
+	for _, state := range []leds.State{s.crossfade.from, s.frame} {
+		for strip, pixels := range state {
+			for pixel := range pixels {
+				if _, ok := frame[strip][pixel]; ok {
+					continue
+				}
+
+				coord := rows.Coord{Strip: strip, Pixel: pixel}
+				frame.Set(strip, pixel, leds.Mix(
+					s.crossfade.from[strip][pixel],
+					s.frame[strip][pixel],
+					s.mix(coord, progress),
+				))
+			}
+		}
+	}
+
+	return frame
+}
+
+// mix returns how much of the incoming program a pixel shows, between 0 and
+// 1.
+func (s *Scheduler) mix(coord rows.Coord, progress float64) float64 {
+	switch s.transition {
+	case TransitionWipe:
+		// pixels off the rows of buttons fade
+		if at, ok := wipePositions[coord]; ok {
+			return sweep(progress, at)
+		}
+	case TransitionSparkle:
+		at, ok := s.crossfade.sparkle[coord]
+		if !ok {
+			at = rand.Float64()
+			s.crossfade.sparkle[coord] = at
+		}
+		return sweep(progress, at)
+	}
+
+	return progress
+}
+
+// sweep fades a pixel in as progress passes at, over edge.
+func sweep(progress, at float64) float64 {
+	return max(0, min(1, (progress*(1+edge)-at)/edge))
+}
+
+func (none) Name() string               { return "" }
+func (none) Press(program.Coord)        {}
+func (none) EQ(equalizer.DisplayData)   {}
+func (none) Play() <-chan program.Sound { return nil }
+func (none) PlayWithEQ() <-chan string  { return nil }
+func (none) Render() <-chan leds.State  { return nil }
+func (none) Yield() <-chan struct{}     { return nil }
+func (none) Close()                     {}
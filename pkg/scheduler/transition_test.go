@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/siggy/bbox/pkg/clock"
+	"github.com/siggy/bbox/pkg/leds"
+)
+
+func TestTransition(t *testing.T) {
+	red := leds.Color{R: 200}
+	blue := leds.Color{B: 200}
+
+	for _, transition := range []Transition{TransitionFade, TransitionWipe, TransitionSparkle} {
+		t.Run(transition.String(), func(t *testing.T) {
+			fake := clock.NewFake(time.Unix(0, 0))
+			s, err := New(context.Background(), []Entry{entry("a"), entry("b")},
+				WithClock(fake),
+				WithTransition(transition, time.Second),
+			)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer s.Close()
+
+			s.Start()
+			first := s.Current().(*stub)
+
+			// pixel 0 is lit by both programs, pixel 1 only by the first
+			s.Render(leds.State{0: {0: red, 1: red}})
+			s.Next(ReasonCommand)
+
+			if s.Outgoing() != first {
+				t.Fatalf("outgoing program is %v, want the first", s.Outgoing())
+			}
+			if first.closed {
+				t.Fatal("outgoing program closed before the transition ended")
+			}
+
+			frame := s.Render(leds.State{0: {0: blue}})
+			if got := frame[0][0]; got != red {
+				t.Errorf("pixel 0 is %s at the start, want %s", got, red)
+			}
+
+			fake.Advance(time.Second)
+			frame = s.Frame()
+
+			if got := frame[0][0]; got != blue {
+				t.Errorf("pixel 0 is %s at the end, want %s", got, blue)
+			}
+			if got, ok := frame[0][1]; !ok || got != leds.Black {
+				t.Errorf("pixel 1 is %s at the end, want %s", got, leds.Black)
+			}
+			if !first.closed {
+				t.Error("outgoing program not closed after the transition")
+			}
+			if _, ok := s.Outgoing().(none); !ok {
+				t.Error("still transitioning after the transition")
+			}
+			if s.Frames() != nil {
+				t.Error("Frames is not nil after the transition")
+			}
+		})
+	}
+}
+
+func TestTransitionCut(t *testing.T) {
+	s, err := New(context.Background(), []Entry{entry("a"), entry("b")}, WithTransition(TransitionCut, time.Second))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer s.Close()
+
+	s.Start()
+	first := s.Current().(*stub)
+	s.Next(ReasonCommand)
+
+	if !first.closed {
+		t.Error("cut did not close the program")
+	}
+	if s.Frames() != nil {
+		t.Error("cut is transitioning")
+	}
+}
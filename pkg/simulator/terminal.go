@@ -0,0 +1,165 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/rows"
+	log "github.com/sirupsen/logrus"
+)
+
+// Terminal is a fake SCORPIO. It accepts the same serial packets as the real
+// board and renders the resulting pixels as 24-bit ANSI color blocks.
+type Terminal struct {
+	out    io.Writer
+	layout rows.Layout
+
+	mu      sync.Mutex
+	pending []byte
+	state   leds.State
+	started bool
+
+	log *log.Entry
+}
+
+const (
+	// maxColumns caps the width of a rendered ring, longer rings are
+	// downsampled by keeping the brightest pixel in each column.
+	maxColumns = 96
+
+	clearScreen = "\033[2J"
+	cursorHome  = "\033[H"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+	resetColor  = "\033[0m"
+	block       = "█"
+
+	// use \r\n, keyboard input puts the terminal in raw mode
+	newline = "\r\n"
+)
+
+// New returns an LEDs implementation that renders to stdout.
+func New(ctx context.Context, stripLengths []int, layout rows.Layout) (leds.LEDs, error) {
+	if len(layout) == 0 {
+		return nil, errors.New("empty layout")
+	}
+
+	return leds.NewWriter(ctx, NewTerminal(os.Stdout, layout), stripLengths), nil
+}
+
+func NewTerminal(out io.Writer, layout rows.Layout) *Terminal {
+	return &Terminal{
+		out:    out,
+		layout: layout,
+		state:  leds.State{},
+		log:    log.WithField("leds", "simulator"),
+	}
+}
+
+// Write decodes SCORPIO packets and renders the updated state.
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, p...)
+
+	updated := false
+	for len(t.pending) > 0 {
+		state, n, err := leds.ParsePacket(t.pending)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		t.pending = t.pending[n:]
+		if err != nil {
+			t.log.Warnf("ParsePacket failed: %v", err)
+			continue
+		}
+
+		if len(state) > 0 {
+			t.state.Apply(state)
+			updated = true
+		}
+	}
+
+	if updated {
+		if err := t.render(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (t *Terminal) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := io.WriteString(t.out, resetColor+showCursor+newline)
+	return err
+}
+
+func (t *Terminal) render() error {
+	var sb strings.Builder
+
+	if !t.started {
+		sb.WriteString(clearScreen + hideCursor)
+		t.started = true
+	}
+	sb.WriteString(cursorHome)
+
+	for i, ring := range t.layout {
+		columns := len(ring.Pixels)
+		perColumn := 1
+		if columns > maxColumns {
+			perColumn = (columns + maxColumns - 1) / maxColumns
+			columns = (columns + perColumn - 1) / perColumn
+		}
+
+		fmt.Fprintf(&sb, "%2d ", i)
+		for col := range columns {
+			brightest := leds.Black
+			for _, pixel := range ring.Pixels[col*perColumn : min((col+1)*perColumn, len(ring.Pixels))] {
+				c := t.state[pixel.Strip][pixel.Pixel]
+				if luma(c) > luma(brightest) {
+					brightest = c
+				}
+			}
+
+			r, g, b := toRGB(brightest)
+			fmt.Fprintf(&sb, "\033[38;2;%d;%d;%dm%s", r, g, b, block)
+		}
+		sb.WriteString(resetColor + newline)
+
+		if len(ring.Buttons) == 0 {
+			continue
+		}
+
+		markers := []byte(strings.Repeat(" ", columns))
+		for _, button := range ring.Buttons {
+			markers[button/perColumn] = '^'
+		}
+		sb.WriteString("   " + string(markers) + newline)
+	}
+
+	_, err := io.WriteString(t.out, sb.String())
+	return err
+}
+
+// toRGB folds the white channel of an RGBW color into RGB.
+func toRGB(c leds.Color) (uint8, uint8, uint8) {
+	add := func(a, b uint8) uint8 {
+		return uint8(min(int(a)+int(b), 255))
+	}
+
+	return add(c.R, c.W), add(c.G, c.W), add(c.B, c.W)
+}
+
+func luma(c leds.Color) int {
+	return int(c.R) + int(c.G) + int(c.B) + int(c.W)
+}
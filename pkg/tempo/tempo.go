@@ -0,0 +1,306 @@
+// Package tempo detects onsets, such as kicks and claps, in live audio, and
+// tracks the tempo and beat phase of the music from them.
+package tempo
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mjibson/go-dsp/fft"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Onset is a transient in the audio.
+	Onset struct {
+		At time.Time
+		// Strength is how far the onset rose over the detection threshold,
+		// 1 and up
+		Strength float64
+	}
+
+	// Tempo is an estimate of the beat of the music.
+	Tempo struct {
+		BPM float64
+		// Beat is the time of a recent beat, the others fall every 60/BPM
+		// seconds before and after it
+		Beat time.Time
+		// Confidence is between 0 and 1
+		Confidence float64
+	}
+
+	// Detector analyzes audio fed to AddSamples. It is safe to feed from an
+	// audio callback, analysis is cheap and never blocks on readers.
+	Detector struct {
+		rate int
+
+		mu     sync.Mutex
+		buf    []float64
+		window []float64
+		// prev is the previous frame's log magnitude spectrum
+		prev []float64
+		// flux is the onset strength of each hop, the newest last
+		flux []float64
+		// hops is the number of hops analyzed
+		hops int64
+		// lastOnset is the hop of the last onset
+		lastOnset int64
+		// bufEnd is the wall time of the end of buf
+		bufEnd time.Time
+
+		onsets chan Onset
+		tempos chan Tempo
+
+		log *log.Entry
+	}
+)
+
+const (
+	fftSize = 1024
+	hopSize = fftSize / 2
+
+	// compression applied to magnitudes before taking the flux, so quiet and
+	// loud passages both register
+	compression = 100
+
+	// an onset rises thresholdRatio over the average flux of the last
+	// thresholdHops, and at least minFlux
+	thresholdRatio = 1.5
+	thresholdHops  = 16
+	minFlux        = 1.0
+	// minOnsetGap drops onsets closer together than a 32nd note at 240 BPM
+	minOnsetGap = 30 * time.Millisecond
+
+	// tempo is estimated every estimateInterval from the last history of
+	// flux, once there is at least minHistory of it
+	history          = 6 * time.Second
+	minHistory       = 3 * time.Second
+	estimateInterval = 500 * time.Millisecond
+
+	minBPM = 60
+	maxBPM = 200
+	// the search prefers tempos near preferredBPM, within about an octave
+	preferredBPM = 120
+	octaveWidth  = 1.0
+
+	// minConfidence is the lowest confidence reported by Tempos
+	minConfidence = 0.15
+
+	channelBuffer = 100
+)
+
+// New returns a Detector for audio at rate Hz.
+func New(rate int) *Detector {
+	window := make([]float64, fftSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(fftSize-1))
+	}
+
+	return &Detector{
+		rate:      rate,
+		window:    window,
+		prev:      make([]float64, fftSize/2),
+		lastOnset: math.MinInt64 / 2,
+		onsets:    make(chan Onset, channelBuffer),
+		tempos:    make(chan Tempo, channelBuffer),
+		log:       log.WithField("bbox", "tempo"),
+	}
+}
+
+// Onsets receives every onset detected, dropped if not read in time.
+func (d *Detector) Onsets() <-chan Onset {
+	return d.onsets
+}
+
+// Tempos receives a new estimate about every estimateInterval, while the music
+// has a clear enough beat. Estimates are dropped if not read in time.
+func (d *Detector) Tempos() <-chan Tempo {
+	return d.tempos
+}
+
+// AddSamples analyzes mono samples that have just been captured or played.
+func (d *Detector) AddSamples(samples []float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buf = append(d.buf, samples...)
+	d.bufEnd = time.Now()
+
+	frame := make([]float64, fftSize)
+	for len(d.buf) >= fftSize {
+		for i := range frame {
+			frame[i] = d.buf[i] * d.window[i]
+		}
+		d.buf = d.buf[hopSize:]
+
+		d.analyze(frame)
+	}
+}
+
+// hopsPerSecond is the rate of flux values.
+func (d *Detector) hopsPerSecond() float64 {
+	return float64(d.rate) / hopSize
+}
+
+// hopTime returns the wall time of the middle of a hop's frame.
+func (d *Detector) hopTime(hop int64) time.Time {
+	// buf starts hopSize into the last frame analyzed
+	samples := float64(d.hops-hop)*hopSize + float64(len(d.buf)) - fftSize/2
+	return d.bufEnd.Add(-time.Duration(samples / float64(d.rate) * float64(time.Second)))
+}
+
+// analyze adds the spectral flux of frame to the history, then looks for an
+// onset and periodically estimates the tempo.
+func (d *Detector) analyze(frame []float64) {
+	spectrum := fft.FFTReal(frame)
+
+	flux := 0.0
+	for i := range d.prev {
+		mag := math.Log1p(compression * math.Hypot(real(spectrum[i]), imag(spectrum[i])) / (fftSize / 2))
+		if rise := mag - d.prev[i]; rise > 0 {
+			flux += rise
+		}
+		d.prev[i] = mag
+	}
+
+	d.flux = append(d.flux, flux)
+	if keep := int(history.Seconds() * d.hopsPerSecond()); len(d.flux) > keep {
+		d.flux = d.flux[len(d.flux)-keep:]
+	}
+	d.hops++
+
+	d.detectOnset()
+
+	if d.hops%int64(estimateInterval.Seconds()*d.hopsPerSecond()) == 0 &&
+		len(d.flux) >= int(minHistory.Seconds()*d.hopsPerSecond()) {
+		if tempo, ok := d.estimate(); ok {
+			select {
+			case d.tempos <- tempo:
+			default:
+			}
+		}
+	}
+}
+
+// detectOnset checks whether the previous hop is a peak above the threshold,
+// now that the hop after it is known.
+func (d *Detector) detectOnset() {
+	n := len(d.flux)
+	if n < thresholdHops+2 {
+		return
+	}
+
+	peak := d.flux[n-2]
+	if peak <= d.flux[n-3] || peak < d.flux[n-1] {
+		return
+	}
+
+	mean := 0.0
+	for _, f := range d.flux[n-2-thresholdHops : n-2] {
+		mean += f
+	}
+	mean /= thresholdHops
+
+	threshold := max(mean*thresholdRatio, minFlux)
+	hop := d.hops - 2
+	gap := int64(minOnsetGap.Seconds() * d.hopsPerSecond())
+	if peak <= threshold || hop-d.lastOnset < gap {
+		return
+	}
+	d.lastOnset = hop
+
+	onset := Onset{At: d.hopTime(hop), Strength: peak / threshold}
+	d.log.Tracef("onset: %+v", onset)
+
+	select {
+	case d.onsets <- onset:
+	default:
+	}
+}
+
+// estimate finds the beat period by autocorrelating the flux history, then the
+// phase by lining a comb of beats up with it.
+func (d *Detector) estimate() (Tempo, bool) {
+	env := onsetEnvelope(d.flux)
+	hps := d.hopsPerSecond()
+
+	ac := func(lag int) float64 {
+		sum := 0.0
+		for i := lag; i < len(env); i++ {
+			sum += env[i] * env[i-lag]
+		}
+		return sum / float64(len(env)-lag)
+	}
+
+	energy := ac(0)
+	if energy == 0 {
+		return Tempo{}, false
+	}
+
+	minLag := int(60 * hps / maxBPM)
+	maxLag := int(math.Ceil(60 * hps / minBPM))
+	corr := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1 && lag < len(env); lag++ {
+		corr[lag] = ac(lag)
+	}
+
+	best, bestScore := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		// a log-gaussian prior picks between multiples of the same beat
+		octaves := math.Log2(60 * hps / float64(lag) / preferredBPM)
+		score := corr[lag] * math.Exp(-0.5*octaves*octaves/(octaveWidth*octaveWidth))
+		if score > bestScore {
+			best, bestScore = lag, score
+		}
+	}
+	if best == 0 {
+		return Tempo{}, false
+	}
+
+	// refine the period between hops with a parabola through the peak
+	period := float64(best)
+	if a, b, c := corr[best-1], corr[best], corr[best+1]; a-2*b+c < 0 {
+		period += 0.5 * (a - c) / (a - 2*b + c)
+	}
+
+	confidence := min(1, corr[best]/energy)
+	if confidence < minConfidence {
+		return Tempo{}, false
+	}
+
+	// phase is how many hops ago the last beat was
+	phase, phaseScore := 0, -1.0
+	for p := range best {
+		score := 0.0
+		for beat := float64(len(env) - 1 - p); beat >= 0; beat -= period {
+			score += env[int(math.Round(beat))]
+		}
+		if score > phaseScore {
+			phase, phaseScore = p, score
+		}
+	}
+
+	return Tempo{
+		BPM:        60 * hps / period,
+		Beat:       d.hopTime(d.hops - 1 - int64(phase)),
+		Confidence: confidence,
+	}, true
+}
+
+// onsetEnvelope removes the local average from flux, leaving the rises.
+func onsetEnvelope(flux []float64) []float64 {
+	env := make([]float64, len(flux))
+	for i := range flux {
+		start := max(0, i-thresholdHops)
+		mean := 0.0
+		for _, f := range flux[start:i] {
+			mean += f
+		}
+		if i > start {
+			mean /= float64(i - start)
+		}
+		env[i] = max(0, flux[i]-mean)
+	}
+	return env
+}
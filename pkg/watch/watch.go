@@ -0,0 +1,157 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Watcher polls files and directories, and reports a path once its
+	// contents have changed and then stayed the same for one interval, so
+	// files still being copied in are not reported half-written.
+	Watcher struct {
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		paths    []string
+		interval time.Duration
+		changes  chan string
+
+		log *log.Entry
+	}
+
+	// fingerprint of a file, or of every file in a directory
+	fingerprint map[string]stat
+
+	stat struct {
+		size    int64
+		modTime time.Time
+	}
+)
+
+const changeBuffer = 10
+
+func New(ctx context.Context, interval time.Duration, paths ...string) *Watcher {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{
+		ctx:    ctx,
+		cancel: cancel,
+
+		paths:    paths,
+		interval: interval,
+		changes:  make(chan string, changeBuffer),
+
+		log: log.WithField("bbox", "watch"),
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w
+}
+
+// Changes returns the paths that changed.
+func (w *Watcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *Watcher) Close() {
+	w.cancel()
+	w.wg.Wait()
+	close(w.changes)
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	reported := make([]fingerprint, len(w.paths))
+	last := make([]fingerprint, len(w.paths))
+	for i, path := range w.paths {
+		fp, err := scan(path)
+		if err != nil {
+			w.log.Warnf("scan failed: %v", err)
+		}
+		reported[i] = fp
+		last[i] = fp
+	}
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			for i, path := range w.paths {
+				fp, err := scan(path)
+				if err != nil {
+					w.log.Tracef("scan failed: %v", err)
+					continue
+				}
+
+				settled := fp.equal(last[i])
+				last[i] = fp
+				if !settled || fp.equal(reported[i]) {
+					continue
+				}
+
+				w.log.Debugf("changed: %s", path)
+				reported[i] = fp
+
+				select {
+				case w.changes <- path:
+				case <-w.ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+func scan(path string) (fingerprint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat failed: %w", err)
+	}
+
+	fp := fingerprint{}
+	if !info.IsDir() {
+		fp[path] = stat{size: info.Size(), modTime: info.ModTime()}
+		return fp, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("read dir failed: %w", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// removed while scanning
+			continue
+		}
+		fp[filepath.Join(path, entry.Name())] = stat{size: info.Size(), modTime: info.ModTime()}
+	}
+
+	return fp, nil
+}
+
+func (f fingerprint) equal(other fingerprint) bool {
+	if len(f) != len(other) {
+		return false
+	}
+	for name, s := range f {
+		if o, ok := other[name]; !ok || !s.modTime.Equal(o.modTime) || s.size != o.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package wavs
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/siggy/bbox/pkg/mix"
+)
+
+type (
+	// clock maps wall time to frames of the stream. It is anchored to the
+	// first frame read, and re-anchored only if the audio device drifts from
+	// the wall clock, so frames for nearby times stay evenly spaced.
+	clock struct {
+		mu       sync.Mutex
+		anchored bool
+		frame    int64
+		time     time.Time
+	}
+
+	clockReader struct {
+		clock *clock
+		seq   *mix.Sequencer
+	}
+)
+
+// maxDrift re-anchors the clock, it must exceed the jitter of the device's
+// reads, which are roughly bufferSize apart
+const maxDrift = 3 * bufferSize
+
+func (c *clock) reader(seq *mix.Sequencer) io.Reader {
+	return &clockReader{clock: c, seq: seq}
+}
+
+func (r *clockReader) Read(p []byte) (int, error) {
+	r.clock.observe(r.seq.Frame(), time.Now())
+	return r.seq.Read(p)
+}
+
+// observe records that frame was read at now.
+func (c *clock) observe(frame int64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.anchored {
+		drift := time.Duration(frame-c.frameAtLocked(now)) * time.Second / mix.SampleRate
+		if drift.Abs() < maxDrift {
+			return
+		}
+	}
+
+	c.anchored = true
+	c.frame = frame
+	c.time = now
+}
+
+// frameAt returns the frame read at time t. It returns false until the stream
+// has been read.
+func (c *clock) frameAt(t time.Time) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.anchored {
+		return 0, false
+	}
+	return c.frameAtLocked(t), true
+}
+
+func (c *clock) frameAtLocked(t time.Time) int64 {
+	return c.frame + int64(t.Sub(c.time).Seconds()*mix.SampleRate)
+}
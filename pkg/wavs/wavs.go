@@ -1,169 +1,323 @@
 package wavs
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ebitengine/oto/v3"
 	"github.com/siggy/bbox/pkg/equalizer"
+	"github.com/siggy/bbox/pkg/mix"
+	"github.com/siggy/bbox/pkg/program"
 	log "github.com/sirupsen/logrus"
-	"github.com/youpy/go-wav"
 )
 
-type Wavs struct {
-	ctx     *oto.Context
-	buffers map[string][]byte
+type (
+	Wavs struct {
+		ctx    *oto.Context
+		player *oto.Player
+		seq    *mix.Sequencer
+		clock  *clock
+		dir    string
 
-	playersLock sync.Mutex
-	players     []*oto.Player
+		libraryLock sync.RWMutex
+		library     Library
 
-	eq  *equalizer.Equalizer
-	log *log.Entry
-}
+		eq *equalizer.Equalizer
+		// mic is set when the equalizer follows AddEQSamples instead of the
+		// sounds played
+		mic atomic.Bool
+
+		log *log.Entry
+	}
+
+	// Library is every sound in the wav directory.
+	Library struct {
+		// buffers are decoded into memory up front, except for long files,
+		// which stream from disk
+		buffers map[string][]float32
+		// paths locate every sound on disk
+		paths map[string]string
+	}
+)
+
+const (
+	// bufferSize is how far ahead of the speaker the stream is rendered, and
+	// so how far ahead of time PlayAt needs to be called
+	bufferSize = 20 * time.Millisecond
+)
 
 // EQ now correctly returns a channel of the new DisplayData struct.
 func (w *Wavs) EQ() <-chan equalizer.DisplayData {
 	return w.eq.Data()
 }
 
+// UseMic stops the sounds played from feeding the equalizer, so audio from
+// outside the box, see AddEQSamples, replaces them. Call it before playing.
+func (w *Wavs) UseMic() {
+	w.mic.Store(true)
+}
+
+// AddEQSamples feeds the equalizer audio from outside the box, such as a
+// microphone, at equalizer.SampleRate.
+func (w *Wavs) AddEQSamples(samples []float64) {
+	w.eq.AddSamples(samples)
+}
+
 func New(dir string) (*Wavs, error) {
 	ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
-		SampleRate:   44100,
-		ChannelCount: 1,
+		SampleRate:   mix.SampleRate,
+		ChannelCount: mix.Channels,
 		Format:       oto.FormatSignedInt16LE,
+		BufferSize:   bufferSize,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Oto context: %v", err)
 	}
 	<-ready
 
-	var filenames []string
-	dirs, _ := os.ReadDir(dir)
-	for _, d := range dirs {
-		if d.IsDir() || !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".wav") {
-			continue
-		}
-		filenames = append(filenames, d.Name())
+	library, err := loadDir(dir)
+	if err != nil {
+		return nil, err
 	}
 
-	buffers := make(map[string][]byte)
-	for _, filename := range filenames {
-		filepath := filepath.Join(dir, filename)
-		buf, err := fileToAudioBytes(filepath)
-		if err != nil {
-			return nil, fmt.Errorf("fileToAudioBytes failed: %w", err)
-		}
-		buffers[filename] = buf
-	}
+	seq := mix.NewSequencer()
+	clock := &clock{}
+
+	// a single player streams the sequencer for as long as we run
+	player := ctx.NewPlayer(clock.reader(seq))
+	player.SetBufferSize(int(bufferSize.Seconds()*mix.SampleRate) * mix.BytesPerFrame)
+	player.Play()
 
 	return &Wavs{
 		ctx:     ctx,
-		buffers: buffers,
+		player:  player,
+		seq:     seq,
+		clock:   clock,
+		dir:     dir,
+		library: library,
 		eq:      equalizer.New(16),
 		log:     log.WithField("bbox", "wavs"),
 	}, nil
 }
 
-func (w *Wavs) Play(filename string) {
-	w.play(filename, false)
+// Load re-reads the wav directory into a new Library, only if every file
+// loads. Sounds keep playing from the current one until Use, so the new set can
+// be checked first, see Library.Has.
+func (w *Wavs) Load() (Library, error) {
+	return loadDir(w.dir)
+}
+
+// Use replaces the set of sounds all at once.
+func (w *Wavs) Use(library Library) {
+	w.libraryLock.Lock()
+	w.library = library
+	w.libraryLock.Unlock()
+
+	w.log.Infof("Reloaded %d sounds and %d streams from %s", len(library.buffers), len(library.paths)-len(library.buffers), w.dir)
+}
+
+// Has reports whether filename is in the library.
+func (l Library) Has(filename string) bool {
+	_, ok := l.paths[filename]
+	return ok
+}
+
+// Has reports whether filename was loaded.
+func (w *Wavs) Has(filename string) bool {
+	_, _, ok := w.sound(filename)
+	return ok
+}
+
+// sound returns filename's samples, or its path if it streams from disk.
+func (w *Wavs) sound(filename string) ([]float32, string, bool) {
+	w.libraryLock.RLock()
+	defer w.libraryLock.RUnlock()
+
+	if buf, ok := w.library.buffers[filename]; ok {
+		return buf, "", true
+	}
+	path, ok := w.library.paths[filename]
+	return nil, path, ok
+}
+
+// PlayTrack streams filename from disk now, feeding the equalizer unless
+// UseMic was called, and returns the stream to control playback. Tracks
+// always stream, however short, so they can be paused and seeked. filename may
+// also be in a directory in the wavs directory, see ListTracks.
+func (w *Wavs) PlayTrack(filename string) (program.Track, error) {
+	w.log.Tracef("play track: %s", filename)
+
+	w.libraryLock.RLock()
+	path, ok := w.library.paths[filename]
+	w.libraryLock.RUnlock()
+	if !ok {
+		if !filepath.IsLocal(filename) || !mix.Supported(filename) {
+			return nil, fmt.Errorf("unknown: %s", filename)
+		}
+		path = filepath.Join(w.dir, filename)
+	}
+
+	stream, err := mix.OpenStream(path)
+	if err != nil {
+		return nil, fmt.Errorf("OpenStream failed: %w", err)
+	}
+
+	e := mix.Event{
+		Frame:  w.seq.Frame(),
+		Stream: stream,
+		Params: mix.Params{Gain: 1},
+	}
+	if !w.mic.Load() {
+		e.Tap = w.eq.AddSamples
+	}
+	w.seq.Schedule(e)
+
+	return stream, nil
+}
+
+// ListTracks returns every supported file in dir, a directory in the wavs
+// directory, sorted by name. Tracks in directories are not loaded up front,
+// so they may be added or removed at any time.
+func (w *Wavs) ListTracks(dir string) ([]string, error) {
+	if !filepath.IsLocal(dir) {
+		return nil, fmt.Errorf("not in the wavs directory: %s", dir)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(w.dir, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && mix.Supported(entry.Name()) {
+			tracks = append(tracks, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return tracks, nil
+}
+
+// Play plays filename now.
+func (w *Wavs) Play(filename string, params mix.Params) {
+	w.play(filename, params, time.Time{}, false)
+}
+
+// PlayAt plays filename at time at. The sound starts at the exact sample for
+// at, as long as PlayAt is called at least bufferSize ahead of time. Otherwise
+// it plays as soon as possible.
+func (w *Wavs) PlayAt(filename string, at time.Time, params mix.Params) {
+	w.play(filename, params, at, false)
+}
+
+// PlaySound plays a sound sent by a program.
+func (w *Wavs) PlaySound(sound program.Sound) {
+	w.PlayAt(sound.Name, sound.At, mix.Params{Gain: sound.Gain, Pan: sound.Pan, Choke: sound.Choke})
 }
 
 func (w *Wavs) PlayWithEQ(filename string) {
-	w.play(filename, true)
+	w.play(filename, mix.Params{Gain: 1}, time.Time{}, true)
 }
 
-func (w *Wavs) play(filename string, eq bool) {
-	w.log.Tracef("play: %s", filename)
-	buf, ok := w.buffers[filename]
+func (w *Wavs) play(filename string, params mix.Params, at time.Time, eq bool) {
+	w.log.Tracef("play: %s (%+v)", filename, params)
+	buf, path, ok := w.sound(filename)
 	if !ok {
 		w.log.Warnf("Unknown: %s", filename)
 		return
 	}
 
-	// The equalizer now implements io.Writer, so it can be passed directly.
-	var reader io.Reader = bytes.NewReader(buf)
-	if eq {
-		reader = io.TeeReader(reader, w.eq)
+	e := mix.Event{
+		Frame:   w.seq.Frame(),
+		Samples: buf,
+		Params:  params,
+	}
+	if path != "" {
+		stream, err := mix.OpenStream(path)
+		if err != nil {
+			w.log.Errorf("OpenStream failed: %v", err)
+			return
+		}
+		e.Stream = stream
+	}
+	if !at.IsZero() {
+		if frame, ok := w.clock.frameAt(at); ok {
+			e.Frame = frame
+		}
+	}
+	if eq && !w.mic.Load() {
+		e.Tap = w.eq.AddSamples
 	}
-	player := w.ctx.NewPlayer(reader)
-	player.Play()
 
-	w.playersLock.Lock()
-	w.players = append(w.players, player)
-	w.playersLock.Unlock()
+	w.seq.Schedule(e)
 }
 
 func (w *Wavs) StopAll() {
-	w.playersLock.Lock()
-	defer w.playersLock.Unlock()
+	w.seq.Stop()
+}
 
-	for _, player := range w.players {
-		player.Close()
+// FadeOut fades out every playing sound over d, and drops every sound not yet
+// started. It stops them at once if d is 0.
+func (w *Wavs) FadeOut(d time.Duration) {
+	frames := int(d * mix.SampleRate / time.Second)
+	if frames <= 0 {
+		w.StopAll()
+		return
 	}
+
+	w.seq.FadeOut(frames)
 }
 
 func (w *Wavs) Close() {
 	w.StopAll()
+	w.player.Close()
 	w.ctx.Suspend()
 	w.eq.Close()
 }
 
-func fileToAudioBytes(filename string) ([]byte, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("open failed: %w", err)
+// loadDir decodes every supported file in dir, except long files, which are
+// only checked to be decodable and stream from disk when played.
+func loadDir(dir string) (Library, error) {
+	lib := Library{
+		buffers: make(map[string][]float32),
+		paths:   make(map[string]string),
 	}
-	defer file.Close()
 
-	reader := wav.NewReader(file)
-	format, err := reader.Format()
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("could not get format: %w", err)
+		return Library{}, fmt.Errorf("failed to read %s: %w", dir, err)
 	}
 
-	// Allow 44.1kHz or 16kHz mono audio
-	if format.NumChannels != 1 || (format.SampleRate != 44100 && format.SampleRate != 16000) {
-		return nil, fmt.Errorf("unsupported format (must be 44.1/16kHz mono): %v", format)
-	}
+	for _, entry := range entries {
+		if entry.IsDir() || !entry.Type().IsRegular() || !mix.Supported(entry.Name()) {
+			continue
+		}
+		filename := entry.Name()
+		path := filepath.Join(dir, filename)
+		lib.paths[filename] = path
 
-	var pcm []byte
-	for {
-		samples, err := reader.ReadSamples()
+		info, err := entry.Info()
 		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return nil, fmt.Errorf("ReadSamples failed on file %s with error: %w", filename, err)
-			}
+			return Library{}, fmt.Errorf("stat failed: %w", err)
 		}
-		for _, sample := range samples {
-			var sampleValue int16
-			switch format.AudioFormat {
-			case wav.AudioFormatPCM:
-				sampleValue = int16(reader.IntValue(sample, 0))
-			case wav.AudioFormatIEEEFloat:
-				floatVal := reader.FloatValue(sample, 0)
-				if floatVal > 1.0 {
-					floatVal = 1.0
-				} else if floatVal < -1.0 {
-					floatVal = -1.0
-				}
-				sampleValue = int16(floatVal * 32767)
-			default:
-				return nil, fmt.Errorf("unsupported audio format code: %d", format.AudioFormat)
+
+		if info.Size() >= mix.StreamSize {
+			if err := mix.Probe(path); err != nil {
+				return Library{}, err
 			}
+			continue
+		}
 
-			b := make([]byte, 2)
-			binary.LittleEndian.PutUint16(b, uint16(sampleValue))
-			pcm = append(pcm, b...)
+		buf, err := mix.Decode(path)
+		if err != nil {
+			return Library{}, fmt.Errorf("Decode failed: %w", err)
 		}
+		lib.buffers[filename] = buf
 	}
 
-	return pcm, nil
+	return lib, nil
 }
@@ -0,0 +1,335 @@
+package web
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/siggy/bbox/pkg/leds"
+	"github.com/siggy/bbox/pkg/program"
+	"github.com/siggy/bbox/pkg/rows"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Server streams LED frames and the beat grid to browsers over a
+	// WebSocket, and forwards button presses from the page. It implements
+	// leds.LEDs so it can sit alongside the real strips via leds.Multi.
+	Server struct {
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		http    *http.Server
+		layout  rows.Layout
+		presses chan<- program.Coord
+
+		mu    sync.Mutex
+		state leds.State
+		dirty leds.State
+		grid  *program.Grid
+		// gridDirty is set when grid changed since the last frame
+		gridDirty bool
+		clients   map[*client]struct{}
+
+		log *log.Entry
+	}
+
+	client struct {
+		conn *websocket.Conn
+		send chan message
+		// stale clients missed a frame and need the full state
+		stale bool
+	}
+
+	message struct {
+		Type   string     `json:"type"`
+		Layout []ring     `json:"layout,omitempty"`
+		Pixels []pixel    `json:"pixels,omitempty"`
+		Grid   *[][]bool  `json:"grid,omitempty"`
+		Size   *[2]int    `json:"size,omitempty"`
+		Press  *pressJSON `json:"press,omitempty"`
+	}
+
+	ring struct {
+		Pixels  [][2]int `json:"pixels"`
+		Buttons []int    `json:"buttons,omitempty"`
+	}
+
+	// [strip, pixel, r, g, b, w]
+	pixel [6]int
+
+	pressJSON struct {
+		Row int `json:"row"`
+		Col int `json:"col"`
+	}
+)
+
+const (
+	frameInterval = 33 * time.Millisecond
+	clientBuffer  = 100
+	writeTimeout  = 5 * time.Second
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// upgrader's default CheckOrigin only accepts pages served from the box
+// itself, so other sites open in a browser on the network can't press buttons.
+var upgrader = websocket.Upgrader{}
+
+// New starts serving on addr. Presses from the page are sent to presses, which
+// may be nil to disable remote input.
+func New(ctx context.Context, addr string, layout rows.Layout, presses chan<- program.Coord) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Server{
+		ctx:    ctx,
+		cancel: cancel,
+
+		layout:  layout,
+		presses: presses,
+
+		state:   leds.State{},
+		dirty:   leds.State{},
+		clients: make(map[*client]struct{}),
+
+		log: log.WithField("bbox", "web"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/ws", s.handleWS)
+	s.http = &http.Server{Handler: mux}
+
+	s.log.Infof("Serving on http://%s", listener.Addr())
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		if err := s.http.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Errorf("Serve failed: %v", err)
+		}
+	}()
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.http.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) Clear() {
+	state := leds.State{}
+	for _, ring := range s.layout {
+		for _, coord := range ring.Pixels {
+			state.Set(coord.Strip, coord.Pixel, leds.Black)
+		}
+	}
+	s.Set(state)
+}
+
+func (s *Server) Set(state leds.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Apply(state)
+	s.dirty.Apply(state)
+}
+
+// SetGrid updates the beat grid shown on the page, nil leaves its buttons
+// blank.
+func (s *Server) SetGrid(grid *program.Grid) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case grid == nil && s.grid == nil:
+	case grid == nil:
+		s.grid = nil
+		s.gridDirty = true
+	case s.grid == nil || *s.grid != *grid:
+		g := *grid
+		s.grid = &g
+		s.gridDirty = true
+	}
+}
+
+// run batches frames, mirroring the LED driver tick.
+func (s *Server) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if len(s.dirty) == 0 && !s.gridDirty {
+				s.mu.Unlock()
+				continue
+			}
+			// every frame carries the whole grid, it is small
+			msg := message{Type: "frame", Pixels: toPixels(s.dirty), Grid: toGrid(s.grid)}
+			s.dirty = leds.State{}
+			s.gridDirty = false
+			for c := range s.clients {
+				m := msg
+				if c.stale {
+					m.Pixels = toPixels(s.state)
+				}
+				select {
+				case c.send <- m:
+					c.stale = false
+				default:
+					// slow client, drop the frame and resync later
+					c.stale = true
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Warnf("Upgrade failed: %v", err)
+		return
+	}
+
+	c := &client{
+		conn: conn,
+		send: make(chan message, clientBuffer),
+	}
+
+	s.mu.Lock()
+	size := [2]int{program.Rows, program.Cols}
+	c.send <- message{Type: "layout", Layout: toRings(s.layout), Size: &size}
+	c.send <- message{Type: "frame", Pixels: toPixels(s.state), Grid: toGrid(s.grid)}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	s.log.Infof("Client connected: %s", r.RemoteAddr)
+
+	s.wg.Add(1)
+	go s.write(c)
+
+	s.read(c)
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	close(c.send)
+	s.mu.Unlock()
+
+	s.log.Infof("Client disconnected: %s", r.RemoteAddr)
+}
+
+func (s *Server) read(c *client) {
+	for {
+		msg := message{}
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != "press" || msg.Press == nil {
+			continue
+		}
+
+		press := program.Coord{Row: msg.Press.Row, Col: msg.Press.Col}
+		if s.presses == nil ||
+			press.Row < 0 || press.Row >= program.Rows || press.Col < 0 || press.Col >= program.Cols {
+			s.log.Warnf("Ignoring press: %+v", press)
+			continue
+		}
+
+		s.log.Debugf("press: %+v", press)
+
+		select {
+		case s.presses <- press:
+		case <-s.ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+func (s *Server) write(c *client) {
+	defer s.wg.Done()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				s.log.Debugf("WriteJSON failed: %v", err)
+				return
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func toRings(layout rows.Layout) []ring {
+	rings := make([]ring, len(layout))
+	for i, r := range layout {
+		rings[i].Buttons = r.Buttons
+		for _, coord := range r.Pixels {
+			rings[i].Pixels = append(rings[i].Pixels, [2]int{coord.Strip, coord.Pixel})
+		}
+	}
+	return rings
+}
+
+func toPixels(state leds.State) []pixel {
+	pixels := []pixel{}
+	for strip, stripLEDs := range state {
+		for p, c := range stripLEDs {
+			pixels = append(pixels, pixel{strip, p, int(c.R), int(c.G), int(c.B), int(c.W)})
+		}
+	}
+	return pixels
+}
+
+func toGrid(grid *program.Grid) *[][]bool {
+	if grid == nil {
+		return nil
+	}
+
+	g := make([][]bool, program.Rows)
+	for row := range grid {
+		g[row] = grid[row][:]
+	}
+	return &g
+}